@@ -0,0 +1,380 @@
+// Command reconctl inspects and maintains the scanner's results database.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/recon-scanner/internal/config"
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/normalize"
+	"github.com/recon-scanner/internal/worker"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(db *database.Database, args []string) error
+}
+
+var commands = []command{
+	{"scaling-events", "list recent worker pool scaling decisions", scalingEvents},
+	{"dead-letters", "list tasks that failed after every retry", deadLetters},
+	{"replay-dead-letters", "move dead letters back into the task queue", replayDeadLetters},
+	{"queue", "show durable task queue counts by state", queueStatus},
+	{"enqueue", "queue domains ahead of the bulk list", enqueue},
+	{"apexes", "group stored domains by registrable domain", apexes},
+	{"dangling", "list domains whose CNAME chain points at nothing", dangling},
+	{"wildcards", "list zones that answer for names that do not exist", wildcards},
+	{"subdomains", "list subdomains found by enumeration and where each came from", subdomains},
+	{"zone-transfers", "list name servers that allowed a zone transfer", zoneTransfers},
+	{"mail-security", "show mail security grades, or the domains with one grade", mailSecurity},
+}
+
+func main() {
+	cfg := config.NewHighPerformanceConfig()
+	dbPath := flag.String("db", cfg.DatabasePath, "path to the results database")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "reconctl: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	db, err := database.New(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconctl: failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := cmd.run(db, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "reconctl %s: %v\n", cmd.name, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: reconctl [-db path] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+func scalingEvents(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("scaling-events", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "number of events to show")
+	fs.Parse(args)
+
+	events, err := db.GetScalingEvents(*limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "TIME\tDIRECTION\tFROM\tTO\tTARGET\tCPU\tMEMORY\tREASON")
+	for _, ev := range events {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%.1f°C\t%.1f%%\t%s\n",
+			ev.Time.Format("2006-01-02 15:04:05"), ev.Direction, ev.FromWorkers, ev.ToWorkers,
+			ev.TargetWorkers, ev.CPUTemp, ev.MemoryPercent, ev.Reason)
+	}
+	return w.Flush()
+}
+
+func deadLetters(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "number of dead letters to show (0 for all)")
+	fs.Parse(args)
+
+	letters, err := db.GetDeadLetters(*limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tTASK\tTYPE\tDATA\tATTEMPTS\tCLASS\tFAILED\tERROR")
+	for _, dl := range letters {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			dl.ID, dl.TaskID, dl.TaskType, dl.Data, dl.Attempts, dl.ErrorClass,
+			dl.FailedAt.Format("2006-01-02 15:04:05"), dl.LastError)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(letters) > 0 {
+		fmt.Println("\nReplay them with: reconctl replay-dead-letters")
+	}
+	return nil
+}
+
+func replayDeadLetters(db *database.Database, args []string) error {
+	n, err := db.ReplayDeadLetters(worker.PriorityRetry, config.NewHighPerformanceConfig().PriorityAging)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moved %d dead letters back into the queue\n", n)
+	return nil
+}
+
+func queueStatus(db *database.Database, args []string) error {
+	counts, err := db.CountTasksByState()
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "STATE\tTASKS")
+	for _, state := range []string{database.TaskPending, database.TaskLeased, database.TaskDone, database.TaskFailed} {
+		fmt.Fprintf(w, "%s\t%d\n", state, counts[state])
+	}
+	return w.Flush()
+}
+
+func enqueue(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("enqueue", flag.ExitOnError)
+	priority := fs.Int("priority", worker.PriorityOperator, "task priority, higher runs first")
+	requeue := fs.Bool("requeue", false, "queue domains again even if their task is done or failed")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no domains given")
+	}
+
+	var tasks []database.QueuedTask
+	for _, arg := range fs.Args() {
+		domain, err := normalize.Domain(arg, normalize.Options{})
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, database.QueuedTask{
+			ID:       worker.DomainTaskID(domain),
+			Type:     "DNS",
+			Data:     domain,
+			Priority: *priority,
+		})
+	}
+
+	counts, err := db.EnqueueTasks(tasks, *requeue, config.NewHighPerformanceConfig().PriorityAging)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Queued %d new, raised %d to priority %d, requeued %d, %d already queued at or above it\n",
+		counts.Added, counts.Raised, *priority, counts.Requeued, counts.Queued)
+	if counts.Finished > 0 {
+		fmt.Printf("%d domains were already done or failed; queue them again with -requeue\n", counts.Finished)
+	}
+	return nil
+}
+
+func apexes(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("apexes", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "number of apexes to show")
+	fs.Parse(args)
+
+	// With an apex argument, list the domains under it instead
+	if fs.NArg() > 0 {
+		domains, err := db.GetDomainsByApex(normalize.Apex(fs.Arg(0)))
+		if err != nil {
+			return err
+		}
+		for _, domain := range domains {
+			fmt.Println(domain)
+		}
+		return nil
+	}
+
+	counts, err := db.GetApexCounts(*limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "APEX\tDOMAINS")
+	for _, c := range counts {
+		fmt.Fprintf(w, "%s\t%d\n", c.Apex, c.Domains)
+	}
+	return w.Flush()
+}
+
+func dangling(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("dangling", flag.ExitOnError)
+	service := fs.String("service", "", "only show findings for this provider, e.g. github-pages")
+	limit := fs.Int("limit", 0, "number of findings to show (0 for all)")
+	fs.Parse(args)
+
+	findings, err := db.GetDanglingCNAMEs(*service, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "DOMAIN\tTARGET\tSERVICE\tDETECTED\tREASON\tCHAIN")
+	for _, dc := range findings {
+		svc := dc.Service
+		if svc == "" {
+			svc = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			dc.Domain, dc.Target, svc, dc.DetectedAt.Format("2006-01-02 15:04:05"), dc.Reason,
+			strings.Join(dc.Chain, " -> "))
+	}
+	return w.Flush()
+}
+
+func wildcards(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("wildcards", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "number of zones to show (0 for all)")
+	fs.Parse(args)
+
+	zones, err := db.GetWildcardZones(*limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ZONE\tCHECKED\tADDRESSES\tCNAME TARGETS")
+	for _, wz := range zones {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			wz.Zone, wz.CheckedAt.Format("2006-01-02 15:04:05"), strings.Join(wz.Addresses, " "), strings.Join(wz.CNAMEs, " "))
+	}
+	return w.Flush()
+}
+
+func subdomains(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("subdomains", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "number of subdomains to show (0 for all)")
+	fs.Parse(args)
+
+	// With an apex argument, only list what was found under it
+	parent := ""
+	if fs.NArg() > 0 {
+		parent = normalize.Apex(fs.Arg(0))
+	}
+
+	domains, err := db.GetDiscoveredDomains(parent, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "DOMAIN\tSOURCE\tFROM\tADDRESSES")
+	for _, dd := range domains {
+		addrs := append(append([]string(nil), dd.ARecords...), dd.AAAARecords...)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", dd.Domain, dd.Source, dd.DiscoveredFrom, strings.Join(addrs, " "))
+	}
+	return w.Flush()
+}
+
+func zoneTransfers(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("zone-transfers", flag.ExitOnError)
+	all := fs.Bool("all", false, "include refused and failed attempts")
+	limit := fs.Int("limit", 0, "number of attempts to show (0 for all)")
+	fs.Parse(args)
+
+	// With a domain argument, print the records transferred for it instead
+	if fs.NArg() > 0 {
+		records, err := db.GetTransferRecords(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		w := newTable()
+		for _, rec := range records {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", rec.Name, rec.TTL, rec.Type, rec.Data)
+		}
+		return w.Flush()
+	}
+
+	attempts, err := db.GetZoneTransfers(!*all, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "DOMAIN\tNAMESERVER\tADDRESS\tALLOWED\tMETHOD\tSERIAL\tRECORDS\tERROR")
+	for _, zt := range attempts {
+		errText := zt.Error
+		if errText == "" {
+			errText = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%d\t%d\t%s\n",
+			zt.Domain, zt.NameServer, zt.Address, zt.Allowed, zt.Method, zt.Serial, zt.Records, errText)
+	}
+	return w.Flush()
+}
+
+func mailSecurity(db *database.Database, args []string) error {
+	fs := flag.NewFlagSet("mail-security", flag.ExitOnError)
+	grade := fs.String("grade", "", "list the domains with this grade, e.g. F")
+	limit := fs.Int("limit", 50, "number of domains to list (0 for all)")
+	fs.Parse(args)
+
+	if *grade == "" {
+		counts, err := db.GetMailGradeCounts()
+		if err != nil {
+			return err
+		}
+		w := newTable()
+		fmt.Fprintln(w, "GRADE\tDOMAINS")
+		for _, c := range counts {
+			fmt.Fprintf(w, "%s\t%d\n", c.Grade, c.Domains)
+		}
+		return w.Flush()
+	}
+
+	results, err := db.GetMailSecurity(strings.ToUpper(*grade), *limit)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "DOMAIN\tSCORE\tSPF\tDMARC\tMTA-STS\tTLS-RPT\tBIMI\tDKIM")
+	for _, ms := range results {
+		spf := ms.SPFStatus
+		if ms.SPFAll != "" {
+			spf += " " + ms.SPFAll
+		}
+		dmarc := orDash(ms.DMARCPolicy)
+		if ms.DMARCPolicy != "" && ms.DMARCPct < 100 {
+			dmarc += fmt.Sprintf(" pct=%d", ms.DMARCPct)
+		}
+		mtaSTS := ms.MTASTSMode
+		if mtaSTS == "" && ms.MTASTSRecord != "" {
+			mtaSTS = "record"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%t\t%t\t%s\n",
+			ms.Domain, ms.Score, spf, dmarc, orDash(mtaSTS), ms.TLSRPTRecord != "", ms.BIMIRecord != "",
+			orDash(strings.Join(ms.DKIMSelectors, ",")))
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
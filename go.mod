@@ -2,4 +2,10 @@ module github.com/recon-scanner
 
 go 1.19
 
-require github.com/mattn/go-sqlite3 v1.14.17
+require (
+	github.com/klauspost/compress v1.17.4
+	github.com/mattn/go-sqlite3 v1.14.17
+	golang.org/x/net v0.17.0
+)
+
+require golang.org/x/text v0.13.0 // indirect
@@ -0,0 +1,209 @@
+package checkpoint
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/input"
+)
+
+// ErrInputChanged is returned when a stored checkpoint belongs to a different input file.
+var ErrInputChanged = errors.New("input file changed since last checkpoint")
+
+// Bytes hashed from each end of the input when fingerprinting it
+const fingerprintSample = 1024 * 1024
+
+// Fingerprint of input piped on stdin, which cannot be identified or reread
+const stdinFingerprint = "stdin"
+
+// Position is where a phase can safely resume.
+type Position struct {
+	BatchIndex int
+	ItemIndex  int   // Items completed, i.e. the index of the next one
+	Offset     int64 // Input byte offset to resume reading from
+	Line       int64 // Input lines consumed before Offset
+}
+
+// PositionOf returns the resume position stored in a checkpoint.
+func PositionOf(p *database.Progress) Position {
+	if p == nil {
+		return Position{}
+	}
+	return Position{
+		BatchIndex: p.BatchIndex,
+		ItemIndex:  p.ItemIndex,
+		Offset:     p.InputOffset,
+		Line:       p.InputLine,
+	}
+}
+
+type Checkpointer struct {
+	db          *database.Database
+	runID       string
+	fingerprint string
+	interval    time.Duration
+
+	mu        sync.Mutex
+	pending   map[string]*database.Progress
+	lastSaved map[string]time.Time
+}
+
+func New(db *database.Database, inputPath string, interval time.Duration) (*Checkpointer, error) {
+	// A piped list cannot be fingerprinted, so it never resumes
+	fingerprint := stdinFingerprint
+	if inputPath != input.StdinPath {
+		var err error
+		fingerprint, err = Fingerprint(inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fingerprint %s: %w", inputPath, err)
+		}
+	}
+
+	return &Checkpointer{
+		db:          db,
+		runID:       newRunID(),
+		fingerprint: fingerprint,
+		interval:    interval,
+		pending:     make(map[string]*database.Progress),
+		lastSaved:   make(map[string]time.Time),
+	}, nil
+}
+
+func (c *Checkpointer) RunID() string {
+	return c.runID
+}
+
+// Resume returns the last checkpoint for phase, or nil when the phase has
+// never run. A checkpoint taken against a different input is refused. Input
+// from stdin never resumes: a run reading it starts at the top, and its own
+// checkpoints are not resumed by a later run either. Domains already stored
+// are still skipped, so only the reading is repeated.
+func (c *Checkpointer) Resume(phase string) (*database.Progress, error) {
+	if c.fingerprint == stdinFingerprint {
+		return nil, nil
+	}
+
+	progress, err := c.db.GetLastProgress(phase)
+	if err != nil || progress == nil || progress.InputFingerprint == stdinFingerprint {
+		return nil, err
+	}
+
+	if progress.InputFingerprint != "" && progress.InputFingerprint != c.fingerprint {
+		return nil, fmt.Errorf("%w: phase %s was checkpointed by run %s", ErrInputChanged, phase, progress.RunID)
+	}
+
+	return progress, nil
+}
+
+// Update records progress and writes it out once CheckpointInterval has
+// passed since the phase was last saved.
+func (c *Checkpointer) Update(phase string, pos Position) error {
+	c.mu.Lock()
+	c.pending[phase] = c.progress(phase, pos)
+	due := time.Since(c.lastSaved[phase]) >= c.interval
+	c.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+	return c.flushPhase(phase)
+}
+
+// Save writes a checkpoint immediately, e.g. at a batch boundary.
+func (c *Checkpointer) Save(phase string, pos Position) error {
+	c.mu.Lock()
+	c.pending[phase] = c.progress(phase, pos)
+	c.mu.Unlock()
+
+	return c.flushPhase(phase)
+}
+
+// Flush writes every checkpoint that has not been saved yet.
+func (c *Checkpointer) Flush() error {
+	c.mu.Lock()
+	var phases []string
+	for phase := range c.pending {
+		phases = append(phases, phase)
+	}
+	c.mu.Unlock()
+
+	for _, phase := range phases {
+		if err := c.flushPhase(phase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checkpointer) flushPhase(phase string) error {
+	c.mu.Lock()
+	progress := c.pending[phase]
+	delete(c.pending, phase)
+	c.lastSaved[phase] = time.Now()
+	c.mu.Unlock()
+
+	if progress == nil {
+		return nil
+	}
+	return c.db.SaveProgress(progress)
+}
+
+func (c *Checkpointer) progress(phase string, pos Position) *database.Progress {
+	return &database.Progress{
+		Phase:            phase,
+		BatchIndex:       pos.BatchIndex,
+		ItemIndex:        pos.ItemIndex,
+		InputOffset:      pos.Offset,
+		InputLine:        pos.Line,
+		InputFingerprint: c.fingerprint,
+		RunID:            c.runID,
+		CompletedAt:      time.Now(),
+	}
+}
+
+// Fingerprint identifies an input file by its size and the contents of its
+// first and last megabyte, which is cheap even for the 10M-row lists.
+func Fingerprint(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:", info.Size())
+
+	if _, err := io.CopyN(hash, file, fingerprintSample); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if info.Size() > 2*fingerprintSample {
+		if _, err := file.Seek(-fingerprintSample, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func newRunID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,68 @@
+package checkpoint
+
+import "sync"
+
+// Watermark tracks out-of-order completion of numbered items and reports the
+// position just past the longest finished prefix, which is the only place
+// that is safe to resume from.
+type Watermark struct {
+	mu   sync.Mutex
+	next int
+	last Position
+	done map[int]Position
+	held int // First failed item, or -1; the watermark never passes it
+}
+
+func NewWatermark(start Position) *Watermark {
+	return &Watermark{
+		next: start.ItemIndex,
+		last: start,
+		done: make(map[int]Position),
+		held: -1,
+	}
+}
+
+// Done marks item index as finished. after is the position just past that
+// item. It returns the new resume position.
+func (w *Watermark) Done(index int, after Position) Position {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Nothing past a held item can become the resume position
+	if index >= w.next && (w.held < 0 || index < w.held) {
+		w.done[index] = after
+	}
+	for {
+		pos, ok := w.done[w.next]
+		if !ok {
+			break
+		}
+		delete(w.done, w.next)
+		w.last = pos
+		w.next++
+	}
+	return w.last
+}
+
+// Hold marks item index as failed, so the watermark stops before it and the
+// next run starts there again. It returns the resume position.
+func (w *Watermark) Hold(index int) Position {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if index >= w.next && (w.held < 0 || index < w.held) {
+		w.held = index
+		for i := range w.done {
+			if i > index {
+				delete(w.done, i)
+			}
+		}
+	}
+	return w.last
+}
+
+func (w *Watermark) Mark() Position {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
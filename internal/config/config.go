@@ -14,7 +14,9 @@ const (
 
 type Config struct {
 	// File paths
-	CSVFile      string
+	CSVFile      string // "-" reads the list from stdin
+	InputFormat  string // auto, tranco, umbrella, majestic or text
+	StripWWW     bool   // Fold www.example.com into example.com
 	DatabasePath string
 	
 	// Time-based configuration
@@ -34,6 +36,22 @@ type Config struct {
 	MailPorts     []int
 	DatabasePorts []int
 	
+	// DNS lookups
+	RecordTypes []string
+	SRVNames    []string
+	
+	// Subdomain enumeration, run between DNS resolution and IP extraction
+	EnumerateSubdomains    bool
+	SubdomainWordlist      string // One label per line; empty uses the built-in list
+	SubdomainPermutations  bool   // Also try variations of the names found, e.g. dev-api
+	MaxSubdomainCandidates int    // Names tried under each parent domain
+	
+	// Zone transfer attempts against each domain's name servers
+	ZoneTransfers bool
+	
+	// SPF, DMARC, MTA-STS, TLS-RPT, BIMI and DKIM checks of each domain
+	MailSecurity bool
+	
 	// Resumption
 	CheckpointInterval time.Duration
 	
@@ -56,6 +74,7 @@ func New() *Config {
 	
 	return &Config{
 		CSVFile:      "top10milliondomains.csv",
+		InputFormat:  "auto",
 		DatabasePath: "recon_results.db",
 		
 		// Toronto timezone with full power from 1:37 AM to 6:30 AM
@@ -88,6 +107,12 @@ func New() *Config {
 		MailPorts:     []int{25, 465, 587, 110, 995, 143, 993},
 		DatabasePorts: []int{3306, 5432, 6379, 27017, 1521, 1433},
 		
+		RecordTypes: DefaultRecordTypes(),
+		SRVNames:    DefaultSRVNames(),
+		
+		SubdomainPermutations:  true,
+		MaxSubdomainCandidates: 5000,
+		
 		CheckpointInterval:  time.Minute * 3,
 		ThermalThrottleTemp: 70, // Celsius - throttle if CPU gets too hot
 		MaxMemoryUsage:      12 * 1024 * 1024 * 1024, // 12GB of 16GB available
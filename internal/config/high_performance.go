@@ -10,6 +10,7 @@ type HighPerformanceConfig struct {
 	MaxWorkers        int
 	MinWorkers        int
 	WorkerScaleStep   int
+	ScaleCheckInterval time.Duration
 	BatchSize         int
 	MaxBatchSize      int
 	MinBatchSize      int
@@ -32,10 +33,51 @@ type HighPerformanceConfig struct {
 	WriteTimeout      time.Duration
 	KeepAlive         time.Duration
 	
+	// DNS upstreams
+	Iterative             bool          // Resolve from the root servers down instead of asking upstreams
+	Upstreams             []string      // host[:port], tls://host[:port][#name] or https://host/path; empty uses /etc/resolv.conf
+	DoHMethod             string        // POST or GET for https:// upstreams
+	UpstreamCAFile        string        // PEM roots trusted for DoT and DoH besides the system ones
+	UpstreamQPS           int           // Ceiling per upstream, 0 for none
+	UpstreamCheckInterval time.Duration // Health window and hijack probe period
+	UpstreamMaxErrorRate  float64       // Error share in a window that ejects an upstream
+	UpstreamEjectTime     time.Duration
+	
+	// DNS lookups
+	RecordTypes []string // Queried for every domain: A AAAA CNAME MX NS TXT SOA CAA SRV DS DNSKEY HTTPS SVCB
+	SRVNames    []string // Service labels queried when SRV is selected
+	DNSSEC      bool     // Validate answers from the root trust anchor down
+	
+	// Wildcard detection
+	WildcardProbes int // Random labels resolved under each apex, 0 disables
+	
+	// Zone transfers
+	ZoneTransfers       bool          // Try AXFR, then IXFR, against every name server of a domain
+	ZoneTransferPort    int           // TCP port name servers are asked on
+	ZoneTransferTimeout time.Duration // Per attempt, including reading the zone
+	
+	// Mail security
+	MailSecurity        bool          // Check SPF, DMARC, MTA-STS, TLS-RPT, BIMI and DKIM of every domain
+	DKIMSelectors       []string      // Tried under _domainkey of each domain
+	MTASTSPolicyTimeout time.Duration // Fetch of the HTTPS policy, 0 to skip
+	
+	// DNS answer cache
+	DNSCacheSize           int64 // Bytes, further capped at an eighth of MaxMemoryUsage; 0 disables
+	DNSCacheMaxTTL         time.Duration
+	DNSCacheMaxNegativeTTL time.Duration
+	
+	// Dangling CNAME detection
+	CNAMEFingerprintFile string        // JSON provider fingerprints; empty uses the built-in set
+	DanglingHTTPTimeout  time.Duration // Page fetch for provider fingerprints; 0, the default, skips it
+	
 	// Performance tuning
 	RequestDelay      time.Duration
 	RetryAttempts     int
+	RetryBaseDelay    time.Duration
 	BackoffMultiplier float64
+	PriorityAging     time.Duration // Wait that earns a queued task one priority level
+	TaskLeaseTimeout  time.Duration // Leased tasks not settled by then are handed out again
+	QueuePollInterval time.Duration
 	
 	// Monitoring
 	MetricsInterval   time.Duration
@@ -43,10 +85,15 @@ type HighPerformanceConfig struct {
 	HealthCheckInterval time.Duration
 	
 	// File paths
-	CSVFile          string
+	CSVFile          string // "-" reads the list from stdin
+	InputFormat      string // auto, tranco, umbrella, majestic or text
+	StripWWW         bool   // Fold www.example.com into example.com
 	DatabasePath     string
 	LogFile          string
 	
+	// Resumption
+	CheckpointInterval time.Duration
+	
 	// Port scanning
 	WebPorts         []int
 	InfraPorts       []int
@@ -65,6 +112,7 @@ func NewHighPerformanceConfig() *HighPerformanceConfig {
 		MaxWorkers:      800,
 		MinWorkers:      50,
 		WorkerScaleStep: 25,
+		ScaleCheckInterval: 30 * time.Second,
 		BatchSize:       1000,
 		MaxBatchSize:    5000,
 		MinBatchSize:    100,
@@ -87,10 +135,38 @@ func NewHighPerformanceConfig() *HighPerformanceConfig {
 		WriteTimeout:      5 * time.Second,
 		KeepAlive:         30 * time.Second,
 		
+		// DNS upstreams
+		DoHMethod:             "POST",
+		UpstreamQPS:           500,
+		UpstreamCheckInterval: time.Minute,
+		UpstreamMaxErrorRate:  0.5,
+		UpstreamEjectTime:     5 * time.Minute,
+		
+		// DNS lookups
+		RecordTypes: DefaultRecordTypes(),
+		SRVNames:    DefaultSRVNames(),
+		
+		WildcardProbes: 2,
+		
+		ZoneTransferPort:    53,
+		ZoneTransferTimeout: 30 * time.Second,
+		
+		DKIMSelectors:       DefaultDKIMSelectors(),
+		MTASTSPolicyTimeout: 5 * time.Second,
+		
+		// DNS answer cache
+		DNSCacheSize:           512 * 1024 * 1024, // 512MB
+		DNSCacheMaxTTL:         24 * time.Hour,
+		DNSCacheMaxNegativeTTL: 3 * time.Hour,
+		
 		// Performance tuning
 		RequestDelay:      1 * time.Millisecond,
 		RetryAttempts:     3,
+		RetryBaseDelay:    2 * time.Second,
 		BackoffMultiplier: 2.0,
+		PriorityAging:     30 * time.Second,
+		TaskLeaseTimeout:  10 * time.Minute,
+		QueuePollInterval: time.Second,
 		
 		// Monitoring
 		MetricsInterval:     60 * time.Second,
@@ -99,9 +175,12 @@ func NewHighPerformanceConfig() *HighPerformanceConfig {
 		
 		// File paths
 		CSVFile:      "top10milliondomains.csv",
+		InputFormat:  "auto",
 		DatabasePath: "recon_results.db",
 		LogFile:      "high_performance_recon.log",
 		
+		CheckpointInterval: 3 * time.Minute,
+		
 		// Port scanning
 		WebPorts:      []int{80, 443, 3000, 8080, 8888, 8443, 5000, 9000},
 		InfraPorts:    []int{21, 22, 23, 139, 161, 445, 3389, 5985, 5986},
@@ -113,4 +192,30 @@ func NewHighPerformanceConfig() *HighPerformanceConfig {
 		MaxCPUUsage:      85.0,
 		LoadAvgThreshold: float64(runtime.NumCPU()) * 0.8,
 	}
-}
\ No newline at end of file
+}
+// DefaultRecordTypes are the record types looked up unless a run selects others.
+func DefaultRecordTypes() []string {
+	return []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+}
+
+// DefaultSRVNames are commonly published service labels.
+func DefaultSRVNames() []string {
+	return []string{
+		"_sip._tcp", "_sip._udp", "_sips._tcp", "_sipfederationtls._tcp",
+		"_xmpp-server._tcp", "_xmpp-client._tcp",
+		"_autodiscover._tcp", "_submission._tcp", "_imaps._tcp", "_pop3s._tcp",
+		"_caldavs._tcp", "_carddavs._tcp",
+		"_ldap._tcp", "_kerberos._udp", "_matrix._tcp",
+	}
+}
+
+// DefaultDKIMSelectors are selectors that common mail providers and tools
+// publish keys under.
+func DefaultDKIMSelectors() []string {
+	return []string{
+		"default", "dkim", "mail", "email", "smtp", "k1", "k2", "k3", "s1", "s2",
+		"selector1", "selector2", "google", "key1", "key2", "sig1", "dk",
+		"mandrill", "mailjet", "mxvault", "everlytickey1", "everlytickey2",
+		"zoho", "protonmail", "protonmail2", "protonmail3", "fm1", "fm2", "fm3", "cm",
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DanglingCNAME is a domain whose CNAME chain points at nothing, which
+// usually means whoever claims the target can serve content for the domain.
+type DanglingCNAME struct {
+	Domain     string
+	Chain      []string // CNAME targets, in order
+	Target     string   // Last name in the chain
+	Service    string   // Fingerprinted provider, empty if none matched
+	Reason     string
+	DetectedAt time.Time
+}
+
+const danglingCNAMEsSchema = `
+CREATE TABLE IF NOT EXISTS dangling_cnames (
+	domain TEXT PRIMARY KEY,
+	cname_chain TEXT,
+	target TEXT,
+	service TEXT,
+	reason TEXT,
+	detected_at TEXT
+);`
+
+// saveDangling records or clears the dangling-CNAME finding for a domain,
+// so a rescan that finds the chain fixed removes the old finding.
+func saveDangling(tx *sql.Tx, domain string, dc *DanglingCNAME) error {
+	if dc == nil {
+		_, err := tx.Exec(`DELETE FROM dangling_cnames WHERE domain = ?`, domain)
+		return err
+	}
+
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO dangling_cnames (domain, cname_chain, target, service, reason, detected_at)
+	VALUES (?, ?, ?, ?, ?, ?);`,
+		domain, joinStrings(dc.Chain), dc.Target, dc.Service, dc.Reason, dc.DetectedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetDanglingCNAMEs returns findings, newest first. A limit of zero or less
+// returns all of them; a non-empty service keeps only that provider.
+func (d *Database) GetDanglingCNAMEs(service string, limit int) ([]DanglingCNAME, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT domain, cname_chain, target, service, reason, detected_at FROM dangling_cnames
+	WHERE ? = '' OR service = ?
+	ORDER BY detected_at DESC, domain LIMIT ?`, service, service, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []DanglingCNAME
+	for rows.Next() {
+		var (
+			dc         DanglingCNAME
+			chain      string
+			detectedAt string
+		)
+		if err := rows.Scan(&dc.Domain, &chain, &dc.Target, &dc.Service, &dc.Reason, &detectedAt); err != nil {
+			return nil, err
+		}
+		dc.Chain = splitStrings(chain)
+		dc.DetectedAt, _ = time.Parse(time.RFC3339, detectedAt)
+		findings = append(findings, dc)
+	}
+	return findings, rows.Err()
+}
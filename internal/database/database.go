@@ -2,20 +2,53 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 type DomainResult struct {
 	Domain            string
+	Rank              int64  // Rank in the input list, 0 when unknown
+	Apex              string // Registrable domain per the Public Suffix List
+	Source            string // SourceInput, SourceWordlist or SourcePermutation; empty means input
+	DiscoveredFrom    string // Name an enumerated domain was guessed from
 	ARecords          []string
 	AAAARecords       []string
 	CNAMERecords      []string
+	CNAMEChain        []string       // Every CNAME target from the domain to the final name
+	Dangling          *DanglingCNAME // Set when the chain points at nothing
+	Wildcard          *WildcardZone  // Set when the domain's zone was probed while resolving it
+	WildcardMatch     bool           // Answers look synthesised by the zone's wildcard
+	AuthServer        string         // Authoritative server that answered, in iterative mode
+	LameDelegations   []string       // Delegated servers that did not answer for their zone
+	ZoneTransfers     []ZoneTransfer   // One per name server address tried; nil when not attempted
+	TransferRecords   []TransferRecord // Records of the first transfer a server allowed
+	MailSecurity      *MailSecurity    // SPF, DMARC and related policies; nil when not checked
 	MXRecords         []string
 	NSRecords         []string
 	TXTRecords        []string
+	SOAPrimaryNS      string
+	SOAAdmin          string // Mailbox, e.g. hostmaster@example.com
+	SOASerial         uint32
+	CAARecords        []string
+	SRVRecords        []string // Service label first, e.g. "_sip._tcp 10 5 5060 sip.example.com"
+	HasDS             bool
+	HasDNSKEY         bool
+	DNSSECStatus      string // secure, insecure, bogus or indeterminate; empty when not validated
+	DNSSECReason      string // Why the status is not secure
+	HTTPSRecords      []string
+	SVCBRecords       []string
+	ALPN              []string // Protocols advertised by HTTPS and SVCB records
+	TTLs              map[string]uint32 // Lowest answer TTL per record type
+	Rcodes            map[string]string // Response code per query type, e.g. "MX": "NOERROR"
+	Statuses          map[string]string // Outcome per query type: NOERROR, NODATA, NXDOMAIN, SERVFAIL, REFUSED or TIMEOUT
 	ProcessedAt       time.Time
 	DNSDuration       time.Duration
 	PortScanDuration  time.Duration
@@ -27,7 +60,13 @@ type Database struct {
 }
 
 func New(path string) (*Database, error) {
-	db, err := sql.Open("sqlite3", path)
+	// Wait for competing writers instead of failing with "database is locked"
+	dsn := path
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_busy_timeout=5000"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -38,17 +77,49 @@ func New(path string) (*Database, error) {
 		log.Printf("Warning: could not enable WAL mode: %v", err)
 	}
 
+	// Databases from before domain_ips have addresses only in the domains table
+	hadDomainIPs, err := tableExists(db, "domain_ips")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	// Create the domains table with per-phase duration columns
 	createStmt := `
 	CREATE TABLE IF NOT EXISTS domains (
+		-- List columns are comma-separated, except those marked newline-separated,
+		-- whose values can contain commas themselves
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		domain TEXT UNIQUE,
+		rank INTEGER NOT NULL DEFAULT 0,
+		apex TEXT,
+		source TEXT NOT NULL DEFAULT 'input',
+		discovered_from TEXT NOT NULL DEFAULT '',
 		a_records TEXT,
 		aaaa_records TEXT,
 		cname_records TEXT,
+		cname_chain TEXT,
+		wildcard_match INTEGER NOT NULL DEFAULT 0,
 		mx_records TEXT,
 		ns_records TEXT,
-		txt_records TEXT,
+		txt_records TEXT, -- newline-separated
+		soa_primary_ns TEXT,
+		soa_admin TEXT,
+		soa_serial INTEGER,
+		caa_records TEXT, -- newline-separated
+		srv_records TEXT,
+		has_ds INTEGER NOT NULL DEFAULT 0,
+		has_dnskey INTEGER NOT NULL DEFAULT 0,
+		dnssec_status TEXT,
+		dnssec_reason TEXT,
+		https_records TEXT, -- newline-separated
+		svcb_records TEXT, -- newline-separated
+		alpn TEXT,
+		auth_server TEXT,
+		lame_delegations TEXT, -- newline-separated
+		record_ttls TEXT,
+		record_rcodes TEXT,
+		record_status TEXT,
 		processed_at TEXT,
 		dns_duration INTEGER,
 		portscan_duration INTEGER,
@@ -59,30 +130,275 @@ func New(path string) (*Database, error) {
 		return nil, err
 	}
 
+	// Create the tables owned by the other result stores
+	for _, stmt := range []string{ipsSchema, portsSchema, progressSchema, scalingEventsSchema, deadLettersSchema, tasksSchema, danglingCNAMEsSchema, wildcardZonesSchema, subdomainEnumerationsSchema, zoneTransfersSchema, mailSecuritySchema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := addMissingColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if !hadDomainIPs {
+		if err := backfillDomainIPs(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to fill domain_ips: %w", err)
+		}
+	}
+
+	// Indexes on added columns can only be created once the columns exist
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_domains_apex ON domains(apex)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(tasksIndexes); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Tasks queued before effective_at existed lease in arrival order
+	if _, err := db.Exec(`UPDATE tasks SET effective_at = available_at WHERE state IN (?, ?) AND effective_at = 0`,
+		TaskPending, TaskLeased); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &Database{db: db}, nil
 }
 
+// IsBusy reports whether err is SQLite giving up on a lock held by another
+// connection after the busy timeout. It clears once that writer finishes,
+// so the write is worth trying again.
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
 func (d *Database) SaveDomain(res *DomainResult) error {
 	stmt := `
 	INSERT OR REPLACE INTO domains (
-		domain, a_records, aaaa_records, cname_records, mx_records, ns_records, txt_records, processed_at, dns_duration, portscan_duration, reverse_duration
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+		domain, rank, apex, source, discovered_from, a_records, aaaa_records, cname_records, cname_chain, wildcard_match, mx_records, ns_records, txt_records,
+		soa_primary_ns, soa_admin, soa_serial, caa_records, srv_records, has_ds, has_dnskey, dnssec_status, dnssec_reason, https_records, svcb_records, alpn,
+		auth_server, lame_delegations, record_ttls, record_rcodes, record_status, processed_at, dns_duration, portscan_duration, reverse_duration
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
-	_, err := d.db.Exec(
+	source := res.Source
+	if source == "" {
+		source = SourceInput
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
 		stmt,
 		res.Domain,
+		res.Rank,
+		res.Apex,
+		source,
+		res.DiscoveredFrom,
 		joinStrings(res.ARecords),
 		joinStrings(res.AAAARecords),
 		joinStrings(res.CNAMERecords),
+		joinStrings(res.CNAMEChain),
+		res.WildcardMatch,
 		joinStrings(res.MXRecords),
 		joinStrings(res.NSRecords),
-		joinStrings(res.TXTRecords),
+		joinLines(res.TXTRecords),
+		res.SOAPrimaryNS,
+		res.SOAAdmin,
+		res.SOASerial,
+		joinLines(res.CAARecords),
+		joinStrings(res.SRVRecords),
+		res.HasDS,
+		res.HasDNSKEY,
+		res.DNSSECStatus,
+		res.DNSSECReason,
+		joinLines(res.HTTPSRecords),
+		joinLines(res.SVCBRecords),
+		joinStrings(res.ALPN),
+		res.AuthServer,
+		joinLines(res.LameDelegations),
+		joinTTLs(res.TTLs),
+		joinPairs(res.Rcodes),
+		joinPairs(res.Statuses),
 		res.ProcessedAt.Format(time.RFC3339),
 		int64(res.DNSDuration.Milliseconds()),
 		int64(res.PortScanDuration.Milliseconds()),
 		int64(res.ReverseDuration.Milliseconds()),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Keep the IP -> domain index in sync with the stored records
+	if err := linkDomainIPs(tx, res.Domain, res.ARecords, res.AAAARecords); err != nil {
+		return err
+	}
+
+	if err := saveDangling(tx, res.Domain, res.Dangling); err != nil {
+		return err
+	}
+	if err := saveWildcard(tx, res.Wildcard); err != nil {
+		return err
+	}
+	if err := saveZoneTransfers(tx, res.Domain, res.ZoneTransfers, res.TransferRecords); err != nil {
+		return err
+	}
+	if err := saveMailSecurity(tx, res.MailSecurity); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Columns added to tables after they first shipped. CREATE TABLE IF NOT
+// EXISTS leaves older databases alone, so these are added on open.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"progress", "input_offset", "INTEGER NOT NULL DEFAULT 0"},
+	{"progress", "input_line", "INTEGER NOT NULL DEFAULT 0"},
+	{"domains", "rank", "INTEGER NOT NULL DEFAULT 0"},
+	{"tasks", "rank", "INTEGER NOT NULL DEFAULT 0"},
+	{"domains", "apex", "TEXT"},
+	{"domains", "record_ttls", "TEXT"},
+	{"domains", "record_rcodes", "TEXT"},
+	{"domains", "record_status", "TEXT"},
+	{"domains", "soa_primary_ns", "TEXT"},
+	{"domains", "soa_admin", "TEXT"},
+	{"domains", "soa_serial", "INTEGER"},
+	{"domains", "caa_records", "TEXT"},
+	{"domains", "srv_records", "TEXT"},
+	{"domains", "has_ds", "INTEGER NOT NULL DEFAULT 0"},
+	{"domains", "has_dnskey", "INTEGER NOT NULL DEFAULT 0"},
+	{"domains", "https_records", "TEXT"},
+	{"domains", "svcb_records", "TEXT"},
+	{"domains", "alpn", "TEXT"},
+	{"domains", "cname_chain", "TEXT"},
+	{"domains", "auth_server", "TEXT"},
+	{"domains", "lame_delegations", "TEXT"},
+	{"domains", "dnssec_status", "TEXT"},
+	{"domains", "dnssec_reason", "TEXT"},
+	{"domains", "wildcard_match", "INTEGER NOT NULL DEFAULT 0"},
+	{"domains", "source", "TEXT NOT NULL DEFAULT 'input'"},
+	{"domains", "discovered_from", "TEXT NOT NULL DEFAULT ''"},
+	{"dead_letters", "rank", "INTEGER NOT NULL DEFAULT 0"},
+	{"tasks", "effective_at", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func addMissingColumns(db *sql.DB) error {
+	existing := make(map[string]map[string]bool)
+
+	for _, col := range addedColumns {
+		if existing[col.table] == nil {
+			columns, err := tableColumns(db, col.table)
+			if err != nil {
+				return err
+			}
+			existing[col.table] = columns
+		}
+
+		if existing[col.table][col.column] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", col.table, col.column, err)
+		}
+		existing[col.table][col.column] = true
+	}
+	return nil
+}
+
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// ApexCount is the number of stored domains sharing a registrable domain.
+type ApexCount struct {
+	Apex    string
+	Domains int
+}
+
+// GetApexCounts groups stored domains by apex, largest groups first.
+func (d *Database) GetApexCounts(limit int) ([]ApexCount, error) {
+	rows, err := d.db.Query(`
+	SELECT apex, COUNT(*) AS n FROM domains
+	WHERE apex IS NOT NULL AND apex != ''
+	GROUP BY apex ORDER BY n DESC, apex LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []ApexCount
+	for rows.Next() {
+		var c ApexCount
+		if err := rows.Scan(&c.Apex, &c.Domains); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// GetDomainsByApex returns the stored domains under one registrable domain.
+func (d *Database) GetDomainsByApex(apex string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT domain FROM domains WHERE apex = ? ORDER BY domain`, apex)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
 }
 
 func (d *Database) Close() error {
@@ -102,3 +418,40 @@ func joinStrings(vals []string) string {
 	}
 	return result
 }
+
+// joinLines is joinStrings for records whose text contains commas. Columns
+// stored this way are marked newline-separated in their schema.
+func joinLines(vals []string) string {
+	return strings.Join(vals, "\n")
+}
+
+// splitLines is the inverse of joinLines.
+func splitLines(val string) []string {
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, "\n")
+}
+
+// joinPairs encodes a per-type map as "A=x,MX=y" in key order.
+func joinPairs(pairs map[string]string) string {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]string, len(keys))
+	for i, k := range keys {
+		encoded[i] = k + "=" + pairs[k]
+	}
+	return strings.Join(encoded, ",")
+}
+
+func joinTTLs(ttls map[string]uint32) string {
+	pairs := make(map[string]string, len(ttls))
+	for k, ttl := range ttls {
+		pairs[k] = strconv.FormatUint(uint64(ttl), 10)
+	}
+	return joinPairs(pairs)
+}
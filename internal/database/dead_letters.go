@@ -0,0 +1,88 @@
+package database
+
+import (
+	"time"
+)
+
+// DeadLetter is a task that kept failing after every retry.
+type DeadLetter struct {
+	ID         int64
+	TaskID     string
+	TaskType   string
+	Data       string
+	Rank       int64 // Input list rank of the domain, kept for replay
+	Attempts   int
+	LastError  string
+	ErrorClass string
+	FailedAt   time.Time
+}
+
+const deadLettersSchema = `
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id TEXT,
+	task_type TEXT,
+	data TEXT,
+	rank INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER,
+	last_error TEXT,
+	error_class TEXT,
+	failed_at TEXT
+);`
+
+func (d *Database) SaveDeadLetter(dl *DeadLetter) error {
+	stmt := `
+	INSERT INTO dead_letters (
+		task_id, task_type, data, rank, attempts, last_error, error_class, failed_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := d.db.Exec(
+		stmt,
+		dl.TaskID,
+		dl.TaskType,
+		dl.Data,
+		dl.Rank,
+		dl.Attempts,
+		dl.LastError,
+		dl.ErrorClass,
+		dl.FailedAt.Format(time.RFC3339),
+	)
+	return err
+}
+
+// GetDeadLetters returns up to limit dead letters, oldest first. A limit of
+// zero or less returns all of them.
+func (d *Database) GetDeadLetters(limit int) ([]DeadLetter, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT id, task_id, task_type, data, rank, attempts, last_error, error_class, failed_at
+	FROM dead_letters ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		var (
+			dl       DeadLetter
+			failedAt string
+		)
+		if err := rows.Scan(&dl.ID, &dl.TaskID, &dl.TaskType, &dl.Data, &dl.Rank, &dl.Attempts,
+			&dl.LastError, &dl.ErrorClass, &failedAt); err != nil {
+			return nil, err
+		}
+		dl.FailedAt, _ = time.Parse(time.RFC3339, failedAt)
+		letters = append(letters, dl)
+	}
+
+	return letters, rows.Err()
+}
+
+func (d *Database) DeleteDeadLetter(id int64) error {
+	_, err := d.db.Exec(`DELETE FROM dead_letters WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"database/sql"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+type IPResult struct {
+	IP             string
+	PTRRecord      string   // First PTR name, kept for quick lookups
+	PTRRecords     []string // Every PTR name returned for the address
+	Family         string
+	ProcessedAt    time.Time
+	LookupDuration time.Duration
+	ErrorClass     string // Empty when the reverse lookup succeeded
+}
+
+const ipsSchema = `
+CREATE TABLE IF NOT EXISTS ips (
+	ip TEXT PRIMARY KEY,
+	ptr_record TEXT,
+	ptr_records TEXT,
+	family TEXT,
+	processed_at TEXT,
+	lookup_duration INTEGER,
+	error_class TEXT
+);
+CREATE TABLE IF NOT EXISTS domain_ips (
+	domain TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	PRIMARY KEY (domain, ip)
+);
+CREATE INDEX IF NOT EXISTS idx_domain_ips_ip ON domain_ips(ip);`
+
+func (d *Database) SaveIP(res *IPResult) error {
+	family := res.Family
+	if family == "" {
+		family = IPFamily(res.IP)
+	}
+
+	ptrRecord := res.PTRRecord
+	if ptrRecord == "" && len(res.PTRRecords) > 0 {
+		ptrRecord = res.PTRRecords[0]
+	}
+
+	stmt := `
+	INSERT OR REPLACE INTO ips (
+		ip, ptr_record, ptr_records, family, processed_at, lookup_duration, error_class
+	) VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := d.db.Exec(
+		stmt,
+		res.IP,
+		ptrRecord,
+		joinStrings(res.PTRRecords),
+		family,
+		res.ProcessedAt.Format(time.RFC3339),
+		int64(res.LookupDuration.Milliseconds()),
+		res.ErrorClass,
+	)
+	return err
+}
+
+// GetAllIPsFromDomains returns every distinct address found in the A and
+// AAAA columns of the domains table.
+func (d *Database) GetAllIPsFromDomains() ([]string, error) {
+	rows, err := d.db.Query(`SELECT a_records, aaaa_records FROM domains`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var ips []string
+	for rows.Next() {
+		var aRecords, aaaaRecords sql.NullString
+		if err := rows.Scan(&aRecords, &aaaaRecords); err != nil {
+			return nil, err
+		}
+
+		for _, ip := range append(splitStrings(aRecords.String), splitStrings(aaaaRecords.String)...) {
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	return ips, rows.Err()
+}
+
+// GetDomainsForIP answers "what else is hosted on this address".
+func (d *Database) GetDomainsForIP(ip string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT domain FROM domain_ips WHERE ip = ? ORDER BY domain`, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+func (d *Database) GetIP(ip string) (*IPResult, error) {
+	row := d.db.QueryRow(`
+	SELECT ip, ptr_record, ptr_records, family, processed_at, lookup_duration, error_class
+	FROM ips WHERE ip = ?`, ip)
+
+	var (
+		res         IPResult
+		ptrRecords  sql.NullString
+		processedAt string
+		durationMs  int64
+		errorClass  sql.NullString
+	)
+	err := row.Scan(&res.IP, &res.PTRRecord, &ptrRecords, &res.Family, &processedAt, &durationMs, &errorClass)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res.PTRRecords = splitStrings(ptrRecords.String)
+	res.ProcessedAt, _ = time.Parse(time.RFC3339, processedAt)
+	res.LookupDuration = time.Duration(durationMs) * time.Millisecond
+	res.ErrorClass = errorClass.String
+	return &res, nil
+}
+
+func IPFamily(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed != nil && parsed.To4() == nil {
+		return FamilyIPv6
+	}
+	return FamilyIPv4
+}
+
+func linkDomainIPs(tx *sql.Tx, domain string, ipLists ...[]string) error {
+	if _, err := tx.Exec(`DELETE FROM domain_ips WHERE domain = ?`, domain); err != nil {
+		return err
+	}
+
+	for _, ips := range ipLists {
+		for _, ip := range ips {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO domain_ips (domain, ip) VALUES (?, ?)`, domain, ip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillDomainIPs indexes the addresses already stored in the domains
+// table, splitting the comma-joined A and AAAA columns in SQL.
+func backfillDomainIPs(db *sql.DB) error {
+	_, err := db.Exec(`
+	WITH RECURSIVE split(domain, ip, rest) AS (
+		SELECT domain, '', COALESCE(a_records, '') || ',' || COALESCE(aaaa_records, '') || ','
+		FROM domains WHERE domain IS NOT NULL
+		UNION ALL
+		SELECT domain, substr(rest, 1, instr(rest, ',') - 1), substr(rest, instr(rest, ',') + 1)
+		FROM split WHERE rest != ''
+	)
+	INSERT OR IGNORE INTO domain_ips (domain, ip) SELECT domain, ip FROM split WHERE ip != ''`)
+	return err
+}
+
+func splitStrings(val string) []string {
+	if val == "" {
+		return nil
+	}
+
+	var result []string
+	for _, v := range strings.Split(val, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
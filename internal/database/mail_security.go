@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MailSecurity is the email authentication and transport policy a domain
+// publishes in DNS, with a grade summarising it.
+type MailSecurity struct {
+	Domain string
+
+	SPFRecord   string
+	SPFStatus   string   // none, valid, permerror or temperror
+	SPFAll      string   // The all mechanism that ends the policy, e.g. -all
+	SPFLookups  int      // DNS lookups the policy costs, at most 10 to be valid
+	SPFIncludes []string // Domains reached through include and redirect
+	SPFErrors   []string
+
+	DMARCRecord          string
+	DMARCDomain          string // Where the record was found, the organizational domain if not the domain itself
+	DMARCPolicy          string // none, quarantine or reject
+	DMARCSubdomainPolicy string
+	DMARCPct             int
+	DMARCReportURIs      []string // Aggregate report destinations (rua)
+
+	MTASTSRecord string
+	MTASTSMode   string   // From the HTTPS policy: enforce, testing or none; empty when not fetched
+	MTASTSMX     []string // MX patterns the policy allows
+
+	TLSRPTRecord     string
+	TLSRPTReportURIs []string
+
+	BIMIRecord    string
+	BIMILogo      string // SVG location (l=)
+	BIMIAuthority string // Verified mark certificate location (a=)
+
+	DKIMSelectors []string // Common selectors that publish a key
+
+	Score     int    // 0 to 100
+	Grade     string // A to F
+	CheckedAt time.Time
+}
+
+// MailGradeCount is the number of domains with one mail security grade.
+type MailGradeCount struct {
+	Grade   string
+	Domains int
+}
+
+const mailSecuritySchema = `
+CREATE TABLE IF NOT EXISTS mail_security (
+	-- List columns are comma-separated, except spf_errors, which is newline-separated
+	domain TEXT PRIMARY KEY,
+	spf_record TEXT,
+	spf_status TEXT,
+	spf_all TEXT,
+	spf_lookups INTEGER NOT NULL DEFAULT 0,
+	spf_includes TEXT,
+	spf_errors TEXT, -- newline-separated
+	dmarc_record TEXT,
+	dmarc_domain TEXT,
+	dmarc_policy TEXT,
+	dmarc_subdomain_policy TEXT,
+	dmarc_pct INTEGER NOT NULL DEFAULT 0,
+	dmarc_rua TEXT,
+	mta_sts_record TEXT,
+	mta_sts_mode TEXT,
+	mta_sts_mx TEXT,
+	tlsrpt_record TEXT,
+	tlsrpt_rua TEXT,
+	bimi_record TEXT,
+	bimi_logo TEXT,
+	bimi_authority TEXT,
+	dkim_selectors TEXT,
+	score INTEGER NOT NULL DEFAULT 0,
+	grade TEXT,
+	checked_at TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_mail_security_grade ON mail_security(grade);`
+
+func saveMailSecurity(tx *sql.Tx, ms *MailSecurity) error {
+	if ms == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO mail_security (
+		domain, spf_record, spf_status, spf_all, spf_lookups, spf_includes, spf_errors,
+		dmarc_record, dmarc_domain, dmarc_policy, dmarc_subdomain_policy, dmarc_pct, dmarc_rua,
+		mta_sts_record, mta_sts_mode, mta_sts_mx, tlsrpt_record, tlsrpt_rua,
+		bimi_record, bimi_logo, bimi_authority, dkim_selectors, score, grade, checked_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		ms.Domain, ms.SPFRecord, ms.SPFStatus, ms.SPFAll, ms.SPFLookups, joinStrings(ms.SPFIncludes), joinLines(ms.SPFErrors),
+		ms.DMARCRecord, ms.DMARCDomain, ms.DMARCPolicy, ms.DMARCSubdomainPolicy, ms.DMARCPct, joinStrings(ms.DMARCReportURIs),
+		ms.MTASTSRecord, ms.MTASTSMode, joinStrings(ms.MTASTSMX), ms.TLSRPTRecord, joinStrings(ms.TLSRPTReportURIs),
+		ms.BIMIRecord, ms.BIMILogo, ms.BIMIAuthority, joinStrings(ms.DKIMSelectors), ms.Score, ms.Grade,
+		ms.CheckedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetMailSecurity returns the stored mail security of domains, worst first,
+// only those graded grade unless it is empty. A limit of zero or less
+// returns all of them.
+func (d *Database) GetMailSecurity(grade string, limit int) ([]MailSecurity, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT domain, spf_record, spf_status, spf_all, spf_lookups, spf_includes, spf_errors,
+		dmarc_record, dmarc_domain, dmarc_policy, dmarc_subdomain_policy, dmarc_pct, dmarc_rua,
+		mta_sts_record, mta_sts_mode, mta_sts_mx, tlsrpt_record, tlsrpt_rua,
+		bimi_record, bimi_logo, bimi_authority, dkim_selectors, score, grade, checked_at
+	FROM mail_security
+	WHERE ? = '' OR grade = ?
+	ORDER BY score, domain LIMIT ?`, grade, grade, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MailSecurity
+	for rows.Next() {
+		var (
+			ms                                         MailSecurity
+			includes, spfErrors, rua, mx, tlsRUA, dkim string
+			checkedAt                                  string
+		)
+		err := rows.Scan(&ms.Domain, &ms.SPFRecord, &ms.SPFStatus, &ms.SPFAll, &ms.SPFLookups, &includes, &spfErrors,
+			&ms.DMARCRecord, &ms.DMARCDomain, &ms.DMARCPolicy, &ms.DMARCSubdomainPolicy, &ms.DMARCPct, &rua,
+			&ms.MTASTSRecord, &ms.MTASTSMode, &mx, &ms.TLSRPTRecord, &tlsRUA,
+			&ms.BIMIRecord, &ms.BIMILogo, &ms.BIMIAuthority, &dkim, &ms.Score, &ms.Grade, &checkedAt)
+		if err != nil {
+			return nil, err
+		}
+		ms.SPFIncludes = splitStrings(includes)
+		ms.SPFErrors = splitLines(spfErrors)
+		ms.DMARCReportURIs = splitStrings(rua)
+		ms.MTASTSMX = splitStrings(mx)
+		ms.TLSRPTReportURIs = splitStrings(tlsRUA)
+		ms.DKIMSelectors = splitStrings(dkim)
+		ms.CheckedAt, _ = time.Parse(time.RFC3339, checkedAt)
+		results = append(results, ms)
+	}
+	return results, rows.Err()
+}
+
+// GetMailGradeCounts counts the domains with each mail security grade.
+func (d *Database) GetMailGradeCounts() ([]MailGradeCount, error) {
+	rows, err := d.db.Query(`SELECT grade, COUNT(*) FROM mail_security GROUP BY grade ORDER BY grade`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []MailGradeCount
+	for rows.Next() {
+		var c MailGradeCount
+		if err := rows.Scan(&c.Grade, &c.Domains); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
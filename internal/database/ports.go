@@ -0,0 +1,138 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	PortStateOpen     = "open"
+	PortStateClosed   = "closed"
+	PortStateFiltered = "filtered"
+
+	ProtocolTCP = "tcp"
+)
+
+type PortResult struct {
+	IP          string
+	Port        int
+	Protocol    string
+	State       string
+	IsOpen      bool
+	Banner      string
+	Service     string
+	RTT         time.Duration
+	ProcessedAt time.Time
+}
+
+const portsSchema = `
+CREATE TABLE IF NOT EXISTS ports (
+	ip TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	protocol TEXT NOT NULL DEFAULT 'tcp',
+	state TEXT,
+	banner TEXT,
+	service TEXT,
+	rtt INTEGER,
+	scanned_at TEXT,
+	PRIMARY KEY (ip, port, protocol)
+);
+CREATE INDEX IF NOT EXISTS idx_ports_port ON ports(port, protocol);`
+
+func (d *Database) SavePort(res *PortResult) error {
+	protocol := res.Protocol
+	if protocol == "" {
+		protocol = ProtocolTCP
+	}
+
+	state := res.State
+	if state == "" {
+		state = PortStateClosed
+		if res.IsOpen {
+			state = PortStateOpen
+		}
+	}
+
+	stmt := `
+	INSERT OR REPLACE INTO ports (
+		ip, port, protocol, state, banner, service, rtt, scanned_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := d.db.Exec(
+		stmt,
+		res.IP,
+		res.Port,
+		protocol,
+		state,
+		res.Banner,
+		res.Service,
+		int64(res.RTT.Microseconds()),
+		res.ProcessedAt.Format(time.RFC3339),
+	)
+	return err
+}
+
+func (d *Database) IsPortScanned(ip string, port int) (bool, error) {
+	var count int
+	err := d.db.QueryRow(
+		`SELECT COUNT(*) FROM ports WHERE ip = ? AND port = ? AND protocol = ?`,
+		ip, port, ProtocolTCP,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetUnscannedIPs filters ips down to the ones without a stored TCP result
+// for port.
+func (d *Database) GetUnscannedIPs(ips []string, port int) ([]string, error) {
+	pending, err := d.GetUnscannedPairs(ips, []int{port})
+	if err != nil {
+		return nil, err
+	}
+	return pending[port], nil
+}
+
+// GetUnscannedPairs returns, per port, the addresses that still need a scan.
+// Ports with nothing left to do are omitted from the map. Every (ip, port)
+// pair is checked against the ports table in one anti-join, so scanned
+// addresses are never loaded into memory.
+func (d *Database) GetUnscannedPairs(ips []string, ports []int) (map[int][]string, error) {
+	pending := make(map[int][]string)
+	if len(ips) == 0 || len(ports) == 0 {
+		return pending, nil
+	}
+
+	ipList, err := json.Marshal(ips)
+	if err != nil {
+		return nil, err
+	}
+	portList, err := json.Marshal(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+	SELECT p.value, i.value FROM json_each(?) AS p, json_each(?) AS i
+	WHERE NOT EXISTS (
+		SELECT 1 FROM ports WHERE ip = i.value AND port = p.value AND protocol = ?
+	)
+	ORDER BY p.key, i.key`, string(portList), string(ipList), ProtocolTCP)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			port int
+			ip   string
+		)
+		if err := rows.Scan(&port, &ip); err != nil {
+			return nil, err
+		}
+		pending[port] = append(pending[port], ip)
+	}
+	return pending, rows.Err()
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Progress struct {
+	Phase            string
+	BatchIndex       int
+	ItemIndex        int
+	InputOffset      int64 // Byte offset in the input to resume reading from
+	InputLine        int64 // Input lines consumed before InputOffset
+	InputFingerprint string
+	RunID            string
+	CompletedAt      time.Time
+}
+
+const progressSchema = `
+CREATE TABLE IF NOT EXISTS progress (
+	phase TEXT PRIMARY KEY,
+	batch_index INTEGER,
+	item_index INTEGER,
+	input_offset INTEGER NOT NULL DEFAULT 0,
+	input_line INTEGER NOT NULL DEFAULT 0,
+	input_fingerprint TEXT,
+	run_id TEXT,
+	completed_at TEXT
+);`
+
+// SaveProgress stores the latest checkpoint for a phase, replacing any older one.
+func (d *Database) SaveProgress(p *Progress) error {
+	stmt := `
+	INSERT OR REPLACE INTO progress (
+		phase, batch_index, item_index, input_offset, input_line, input_fingerprint, run_id, completed_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := d.db.Exec(
+		stmt,
+		p.Phase,
+		p.BatchIndex,
+		p.ItemIndex,
+		p.InputOffset,
+		p.InputLine,
+		p.InputFingerprint,
+		p.RunID,
+		p.CompletedAt.Format(time.RFC3339),
+	)
+	return err
+}
+
+// GetLastProgress returns nil without an error when the phase has no checkpoint yet.
+func (d *Database) GetLastProgress(phase string) (*Progress, error) {
+	row := d.db.QueryRow(`
+	SELECT phase, batch_index, item_index, input_offset, input_line, input_fingerprint, run_id, completed_at
+	FROM progress WHERE phase = ?`, phase)
+
+	var (
+		p           Progress
+		fingerprint sql.NullString
+		runID       sql.NullString
+		completedAt string
+	)
+	err := row.Scan(&p.Phase, &p.BatchIndex, &p.ItemIndex, &p.InputOffset, &p.InputLine, &fingerprint, &runID, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.InputFingerprint = fingerprint.String
+	p.RunID = runID.String
+	p.CompletedAt, _ = time.Parse(time.RFC3339, completedAt)
+	return &p, nil
+}
+
+func (d *Database) GetProcessedDomains() (map[string]bool, error) {
+	rows, err := d.db.Query(`SELECT domain FROM domains`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	processed := make(map[string]bool)
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		processed[domain] = true
+	}
+
+	return processed, rows.Err()
+}
+
+// GetProcessedAmong returns which of the given domains already have results,
+// so callers can filter a batch without loading the whole table.
+func (d *Database) GetProcessedAmong(domains []string) (map[string]bool, error) {
+	processed := make(map[string]bool)
+	if len(domains) == 0 {
+		return processed, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(domains))
+	args := make([]interface{}, len(domains))
+	for i, domain := range domains {
+		args[i] = domain
+	}
+
+	rows, err := d.db.Query(`SELECT domain FROM domains WHERE domain IN (`+placeholders[:len(placeholders)-1]+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, err
+		}
+		processed[domain] = true
+	}
+
+	return processed, rows.Err()
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"time"
+)
+
+type ScalingEvent struct {
+	Time          time.Time
+	Direction     string // "up", "down" or "hold"
+	FromWorkers   int
+	ToWorkers     int
+	TargetWorkers int
+	CPUTemp       float64
+	MemoryPercent float64
+	Reason        string
+}
+
+const scalingEventsSchema = `
+CREATE TABLE IF NOT EXISTS scaling_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	occurred_at TEXT,
+	direction TEXT,
+	from_workers INTEGER,
+	to_workers INTEGER,
+	target_workers INTEGER,
+	cpu_temp REAL,
+	memory_percent REAL,
+	reason TEXT
+);`
+
+func (d *Database) SaveScalingEvent(ev *ScalingEvent) error {
+	stmt := `
+	INSERT INTO scaling_events (
+		occurred_at, direction, from_workers, to_workers, target_workers, cpu_temp, memory_percent, reason
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := d.db.Exec(
+		stmt,
+		ev.Time.Format(time.RFC3339),
+		ev.Direction,
+		ev.FromWorkers,
+		ev.ToWorkers,
+		ev.TargetWorkers,
+		ev.CPUTemp,
+		ev.MemoryPercent,
+		ev.Reason,
+	)
+	return err
+}
+
+// GetScalingEvents returns the most recent events, newest first.
+func (d *Database) GetScalingEvents(limit int) ([]ScalingEvent, error) {
+	rows, err := d.db.Query(`
+	SELECT occurred_at, direction, from_workers, to_workers, target_workers, cpu_temp, memory_percent, reason
+	FROM scaling_events ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ScalingEvent
+	for rows.Next() {
+		var (
+			ev         ScalingEvent
+			occurredAt string
+		)
+		if err := rows.Scan(&occurredAt, &ev.Direction, &ev.FromWorkers, &ev.ToWorkers,
+			&ev.TargetWorkers, &ev.CPUTemp, &ev.MemoryPercent, &ev.Reason); err != nil {
+			return nil, err
+		}
+		ev.Time, _ = time.Parse(time.RFC3339, occurredAt)
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
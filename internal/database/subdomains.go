@@ -0,0 +1,116 @@
+package database
+
+import (
+	"time"
+)
+
+// Where a stored domain came from
+const (
+	SourceInput       = "input"       // Listed in the input file
+	SourceWordlist    = "wordlist"    // Guessed from the subdomain wordlist
+	SourcePermutation = "permutation" // Varied from a subdomain already found
+)
+
+// Enumeration summarises the subdomain guesses made under one parent domain.
+type Enumeration struct {
+	Parent     string
+	Candidates int // Names tried
+	Discovered int // Names that exist and were stored
+	Wildcard   int // Names dropped because they only matched the wildcard
+	Errors     int // Names whose lookup failed
+	FinishedAt time.Time
+}
+
+// DiscoveredDomain is a stored domain that enumeration found.
+type DiscoveredDomain struct {
+	Domain         string
+	Source         string
+	DiscoveredFrom string
+	ARecords       []string
+	AAAARecords    []string
+}
+
+const subdomainEnumerationsSchema = `
+CREATE TABLE IF NOT EXISTS subdomain_enumerations (
+	parent TEXT PRIMARY KEY,
+	candidates INTEGER NOT NULL DEFAULT 0,
+	discovered INTEGER NOT NULL DEFAULT 0,
+	wildcard_filtered INTEGER NOT NULL DEFAULT 0,
+	errors INTEGER NOT NULL DEFAULT 0,
+	finished_at TEXT
+);`
+
+// SaveEnumeration records that a parent domain has been enumerated, so later
+// runs skip it.
+func (d *Database) SaveEnumeration(e *Enumeration) error {
+	_, err := d.db.Exec(`
+	INSERT OR REPLACE INTO subdomain_enumerations (parent, candidates, discovered, wildcard_filtered, errors, finished_at)
+	VALUES (?, ?, ?, ?, ?, ?);`,
+		e.Parent, e.Candidates, e.Discovered, e.Wildcard, e.Errors, e.FinishedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetEnumerationParents returns the registrable domains of resolved input
+// domains that have not been enumerated yet, best ranked first. A limit of
+// zero or less returns all of them.
+func (d *Database) GetEnumerationParents(limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT apex FROM domains
+	WHERE source = ? AND apex IS NOT NULL AND apex != ''
+		AND (a_records != '' OR aaaa_records != '' OR ns_records != '')
+		AND apex NOT IN (SELECT parent FROM subdomain_enumerations)
+	GROUP BY apex ORDER BY MIN(CASE WHEN rank > 0 THEN rank END) IS NULL, MIN(CASE WHEN rank > 0 THEN rank END), apex
+	LIMIT ?`, SourceInput, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parents []string
+	for rows.Next() {
+		var parent string
+		if err := rows.Scan(&parent); err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+	}
+	return parents, rows.Err()
+}
+
+// GetDiscoveredDomains returns the domains found by enumeration under parent,
+// or under any parent when it is empty. A limit of zero or less returns all
+// of them.
+func (d *Database) GetDiscoveredDomains(parent string, limit int) ([]DiscoveredDomain, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT domain, source, discovered_from, a_records, aaaa_records FROM domains
+	WHERE source != ? AND (? = '' OR apex = ?)
+	ORDER BY apex, domain LIMIT ?`, SourceInput, parent, parent, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []DiscoveredDomain
+	for rows.Next() {
+		var (
+			dd          DiscoveredDomain
+			aRecords    string
+			aaaaRecords string
+		)
+		if err := rows.Scan(&dd.Domain, &dd.Source, &dd.DiscoveredFrom, &aRecords, &aaaaRecords); err != nil {
+			return nil, err
+		}
+		dd.ARecords = splitStrings(aRecords)
+		dd.AAAARecords = splitStrings(aaaaRecords)
+		domains = append(domains, dd)
+	}
+	return domains, rows.Err()
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Task states in the durable queue
+const (
+	TaskPending = "pending"
+	TaskLeased  = "leased"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+type QueuedTask struct {
+	ID             string
+	Type           string
+	Data           string
+	Rank           int64 // Input list rank of the domain, 0 when unknown
+	Priority       int
+	Retry          int
+	State          string
+	AvailableAt    time.Time
+	EffectiveAt    time.Time // AvailableAt moved earlier by priority*aging; leases go in this order
+	LeaseExpiresAt time.Time
+	LastError      string
+}
+
+// Times are stored as unix seconds so the lease queries can compare them.
+// effective_at is available_at minus priority*aging, kept up to date on every
+// write so that leasing reads idx_tasks_due in order instead of sorting.
+const tasksSchema = `
+CREATE TABLE IF NOT EXISTS tasks (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	data TEXT,
+	rank INTEGER NOT NULL DEFAULT 0,
+	priority INTEGER NOT NULL DEFAULT 0,
+	retry INTEGER NOT NULL DEFAULT 0,
+	state TEXT NOT NULL DEFAULT 'pending',
+	available_at INTEGER NOT NULL DEFAULT 0,
+	effective_at INTEGER NOT NULL DEFAULT 0,
+	lease_expires_at INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	updated_at TEXT
+);
+DROP INDEX IF EXISTS idx_tasks_pending;`
+
+// Created once addMissingColumns has added effective_at to older databases
+const tasksIndexes = `
+CREATE INDEX IF NOT EXISTS idx_tasks_due ON tasks(state, effective_at, available_at);`
+
+// effectiveAt is the lease ordering key of a task due at availableAt.
+func effectiveAt(availableAt time.Time, priority int, aging time.Duration) int64 {
+	return availableAt.Unix() - int64(priority)*int64(aging/time.Second)
+}
+
+// EnqueueCounts says what EnqueueTasks did with the tasks it was given.
+type EnqueueCounts struct {
+	Added    int // Not queued before
+	Raised   int // Already queued; moved up to the new priority
+	Requeued int // Done or failed; back to pending
+	Queued   int // Already queued at the same or a higher priority
+	Finished int // Done or failed, and left that way
+}
+
+// EnqueueTasks adds tasks in one transaction. A task whose ID is already
+// pending or leased keeps the higher of the two priorities. One that is done
+// or failed is left alone so completed work is not redone, unless requeue is
+// set, which puts it back to pending as a fresh task. aging is the wait that
+// earns a task one priority level, as passed to LeaseTasks.
+func (d *Database) EnqueueTasks(tasks []QueuedTask, requeue bool, aging time.Duration) (EnqueueCounts, error) {
+	var counts EnqueueCounts
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return counts, err
+	}
+	defer tx.Rollback()
+
+	existing, err := tx.Prepare(`SELECT state, priority FROM tasks WHERE id = ?`)
+	if err != nil {
+		return counts, err
+	}
+	defer existing.Close()
+
+	upsert, err := tx.Prepare(`
+	INSERT INTO tasks (id, type, data, rank, priority, retry, state, available_at, effective_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET priority = max(priority, excluded.priority),
+		effective_at = available_at - max(priority, excluded.priority) * ?, updated_at = excluded.updated_at
+	WHERE state IN (?, ?);`)
+	if err != nil {
+		return counts, err
+	}
+	defer upsert.Close()
+
+	reset, err := tx.Prepare(`
+	UPDATE tasks SET type = ?, data = ?, rank = ?, priority = ?, retry = 0, state = ?, available_at = ?,
+		effective_at = ?, lease_expires_at = 0, last_error = NULL, updated_at = ?
+	WHERE id = ?`)
+	if err != nil {
+		return counts, err
+	}
+	defer reset.Close()
+
+	now := time.Now()
+	for _, t := range tasks {
+		var (
+			state    string
+			priority int
+		)
+		err := existing.QueryRow(t.ID).Scan(&state, &priority)
+		if err != nil && err != sql.ErrNoRows {
+			return counts, err
+		}
+		found := err == nil
+
+		if found && (state == TaskDone || state == TaskFailed) {
+			if !requeue {
+				counts.Finished++
+				continue
+			}
+			if _, err := reset.Exec(t.Type, t.Data, t.Rank, t.Priority, TaskPending, t.AvailableAt.Unix(),
+				effectiveAt(t.AvailableAt, t.Priority, aging), now.Format(time.RFC3339), t.ID); err != nil {
+				return counts, err
+			}
+			counts.Requeued++
+			continue
+		}
+
+		if _, err := upsert.Exec(t.ID, t.Type, t.Data, t.Rank, t.Priority, t.Retry, TaskPending,
+			t.AvailableAt.Unix(), effectiveAt(t.AvailableAt, t.Priority, aging), now.Format(time.RFC3339),
+			int64(aging/time.Second), TaskPending, TaskLeased); err != nil {
+			return counts, err
+		}
+		switch {
+		case !found:
+			counts.Added++
+		case t.Priority > priority:
+			counts.Raised++
+		default:
+			counts.Queued++
+		}
+	}
+
+	return counts, tx.Commit()
+}
+
+// LeaseTasks claims up to limit pending tasks that are due. Like the worker
+// pool's heap, tasks are ordered by available_at minus priority*aging, so
+// higher priorities go first but long-waiting bulk tasks are not starved;
+// that key is stored as effective_at when the task is written. Leased tasks
+// return to pending if not settled before the lease expires.
+func (d *Database) LeaseTasks(limit int, lease time.Duration) ([]QueuedTask, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.Query(`
+	SELECT id, type, data, rank, priority, retry, available_at, effective_at, last_error FROM tasks
+	WHERE state = ? AND available_at <= ?
+	ORDER BY effective_at, available_at LIMIT ?`, TaskPending, now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []QueuedTask
+	for rows.Next() {
+		var (
+			t           QueuedTask
+			availableAt int64
+			effective   int64
+			lastError   *string
+		)
+		if err := rows.Scan(&t.ID, &t.Type, &t.Data, &t.Rank, &t.Priority, &t.Retry, &availableAt, &effective, &lastError); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.State = TaskLeased
+		t.AvailableAt = time.Unix(availableAt, 0)
+		t.EffectiveAt = time.Unix(effective, 0)
+		t.LeaseExpiresAt = now.Add(lease)
+		if lastError != nil {
+			t.LastError = *lastError
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tasks {
+		if _, err := tx.Exec(`UPDATE tasks SET state = ?, lease_expires_at = ?, updated_at = ? WHERE id = ?`,
+			TaskLeased, t.LeaseExpiresAt.Unix(), now.Format(time.RFC3339), t.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return tasks, tx.Commit()
+}
+
+func (d *Database) CompleteTask(id string) error {
+	return d.setTaskState(id, TaskDone, "")
+}
+
+func (d *Database) FailTask(id string, lastError string) error {
+	return d.setTaskState(id, TaskFailed, lastError)
+}
+
+// RetryTask puts a leased task back to pending, not to be leased before availableAt.
+func (d *Database) RetryTask(id string, retry, priority int, availableAt time.Time, aging time.Duration, lastError string) error {
+	_, err := d.db.Exec(`
+	UPDATE tasks SET state = ?, retry = ?, priority = ?, available_at = ?, effective_at = ?, last_error = ?, updated_at = ?
+	WHERE id = ?`,
+		TaskPending, retry, priority, availableAt.Unix(), effectiveAt(availableAt, priority, aging), lastError,
+		time.Now().Format(time.RFC3339), id)
+	return err
+}
+
+// ReleaseTasks returns leased tasks to pending without counting an attempt.
+func (d *Database) ReleaseTasks(ids []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE tasks SET state = ? WHERE id = ? AND state = ?`,
+			TaskPending, id, TaskLeased); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReleaseAllLeases returns every leased task to pending. It is meant for
+// startup, when leases can only belong to a process that has died.
+func (d *Database) ReleaseAllLeases() (int64, error) {
+	res, err := d.db.Exec(`UPDATE tasks SET state = ? WHERE state = ?`, TaskPending, TaskLeased)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RequeueExpiredLeases returns tasks whose lease ran out to pending.
+func (d *Database) RequeueExpiredLeases() (int64, error) {
+	res, err := d.db.Exec(`UPDATE tasks SET state = ? WHERE state = ? AND lease_expires_at < ?`,
+		TaskPending, TaskLeased, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (d *Database) CountTasksByState() (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT state, COUNT(*) FROM tasks GROUP BY state`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			state string
+			count int
+		)
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		counts[state] = count
+	}
+	return counts, rows.Err()
+}
+
+// ReplayDeadLetters moves every dead letter back into the queue as a fresh
+// pending task with the given priority and returns how many were moved.
+func (d *Database) ReplayDeadLetters(priority int, aging time.Duration) (int, error) {
+	letters, err := d.GetDeadLetters(0)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, dl := range letters {
+		if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO tasks (id, type, data, rank, priority, retry, state, available_at, effective_at, last_error, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?);`,
+			dl.TaskID, dl.TaskType, dl.Data, dl.Rank, priority, TaskPending, now.Unix(),
+			effectiveAt(now, priority, aging), dl.LastError, now.Format(time.RFC3339)); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM dead_letters WHERE id = ?`, dl.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(letters), tx.Commit()
+}
+
+func (d *Database) setTaskState(id, state, lastError string) error {
+	_, err := d.db.Exec(`UPDATE tasks SET state = ?, last_error = ?, updated_at = ? WHERE id = ?`,
+		state, lastError, time.Now().Format(time.RFC3339), id)
+	return err
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WildcardZone is the verdict of probing random names under a zone. Domains
+// whose answers match it are most likely synthesised by the wildcard.
+type WildcardZone struct {
+	Zone      string
+	Wildcard  bool
+	Addresses []string // A and AAAA answers to the probes
+	CNAMEs    []string // Final CNAME targets the probes led to
+	Probes    int
+	CheckedAt time.Time
+}
+
+const wildcardZonesSchema = `
+CREATE TABLE IF NOT EXISTS wildcard_zones (
+	zone TEXT PRIMARY KEY,
+	is_wildcard INTEGER NOT NULL DEFAULT 0,
+	addresses TEXT,
+	cname_targets TEXT,
+	probes INTEGER NOT NULL DEFAULT 0,
+	checked_at TEXT
+);`
+
+func saveWildcard(tx *sql.Tx, wz *WildcardZone) error {
+	if wz == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO wildcard_zones (zone, is_wildcard, addresses, cname_targets, probes, checked_at)
+	VALUES (?, ?, ?, ?, ?, ?);`,
+		wz.Zone, wz.Wildcard, joinStrings(wz.Addresses), joinStrings(wz.CNAMEs), wz.Probes, wz.CheckedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetWildcardZones returns the zones found to have a wildcard, most recently
+// checked first. A limit of zero or less returns all of them.
+func (d *Database) GetWildcardZones(limit int) ([]WildcardZone, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT zone, addresses, cname_targets, probes, checked_at FROM wildcard_zones
+	WHERE is_wildcard = 1
+	ORDER BY checked_at DESC, zone LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []WildcardZone
+	for rows.Next() {
+		var (
+			wz        WildcardZone
+			addresses string
+			cnames    string
+			checkedAt string
+		)
+		if err := rows.Scan(&wz.Zone, &addresses, &cnames, &wz.Probes, &checkedAt); err != nil {
+			return nil, err
+		}
+		wz.Wildcard = true
+		wz.Addresses = splitStrings(addresses)
+		wz.CNAMEs = splitStrings(cnames)
+		wz.CheckedAt, _ = time.Parse(time.RFC3339, checkedAt)
+		zones = append(zones, wz)
+	}
+	return zones, rows.Err()
+}
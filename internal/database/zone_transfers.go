@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ZoneTransfer is one attempt to transfer a domain's zone from one address
+// of one of its name servers.
+type ZoneTransfer struct {
+	Domain      string
+	NameServer  string
+	Address     string
+	Allowed     bool
+	Method      string // AXFR or IXFR
+	Serial      uint32 // SOA serial of the transferred zone
+	Records     int
+	Error       string // Why the transfer failed, e.g. REFUSED
+	AttemptedAt time.Time
+}
+
+// TransferRecord is a record read from a zone transfer.
+type TransferRecord struct {
+	Name       string
+	Type       string
+	TTL        uint32
+	Data       string
+	NameServer string // Server the zone was transferred from
+}
+
+const zoneTransfersSchema = `
+CREATE TABLE IF NOT EXISTS zone_transfers (
+	domain TEXT NOT NULL,
+	nameserver TEXT NOT NULL,
+	address TEXT NOT NULL,
+	allowed INTEGER NOT NULL DEFAULT 0,
+	method TEXT,
+	serial INTEGER,
+	records INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	attempted_at TEXT,
+	PRIMARY KEY (domain, address)
+);
+CREATE TABLE IF NOT EXISTS zone_transfer_records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	domain TEXT NOT NULL,
+	nameserver TEXT,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	ttl INTEGER,
+	data TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_zone_transfer_records_domain ON zone_transfer_records(domain);`
+
+// saveZoneTransfers replaces the attempts and records stored for domain. A
+// nil attempts means no transfer was tried and leaves them alone.
+func saveZoneTransfers(tx *sql.Tx, domain string, attempts []ZoneTransfer, records []TransferRecord) error {
+	if attempts == nil {
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM zone_transfers WHERE domain = ?`, domain); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM zone_transfer_records WHERE domain = ?`, domain); err != nil {
+		return err
+	}
+
+	for _, zt := range attempts {
+		_, err := tx.Exec(`
+		INSERT OR REPLACE INTO zone_transfers (domain, nameserver, address, allowed, method, serial, records, error, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			domain, zt.NameServer, zt.Address, zt.Allowed, zt.Method, zt.Serial, zt.Records, zt.Error, zt.AttemptedAt.Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`
+	INSERT INTO zone_transfer_records (domain, nameserver, name, type, ttl, data)
+	VALUES (?, ?, ?, ?, ?, ?);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rec := range records {
+		if _, err := stmt.Exec(domain, rec.NameServer, rec.Name, rec.Type, rec.TTL, rec.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetZoneTransfers returns transfer attempts, newest first, only those a
+// server allowed when allowedOnly is set. A limit of zero or less returns
+// all of them.
+func (d *Database) GetZoneTransfers(allowedOnly bool, limit int) ([]ZoneTransfer, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := d.db.Query(`
+	SELECT domain, nameserver, address, allowed, method, serial, records, error, attempted_at FROM zone_transfers
+	WHERE allowed = 1 OR ? = 0
+	ORDER BY attempted_at DESC, domain, address LIMIT ?`, allowedOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []ZoneTransfer
+	for rows.Next() {
+		var (
+			zt          ZoneTransfer
+			method      sql.NullString
+			serial      sql.NullInt64
+			errText     sql.NullString
+			attemptedAt string
+		)
+		if err := rows.Scan(&zt.Domain, &zt.NameServer, &zt.Address, &zt.Allowed, &method, &serial, &zt.Records, &errText, &attemptedAt); err != nil {
+			return nil, err
+		}
+		zt.Method = method.String
+		zt.Serial = uint32(serial.Int64)
+		zt.Error = errText.String
+		zt.AttemptedAt, _ = time.Parse(time.RFC3339, attemptedAt)
+		attempts = append(attempts, zt)
+	}
+	return attempts, rows.Err()
+}
+
+// GetTransferRecords returns the records transferred for domain, in the
+// order the server sent them.
+func (d *Database) GetTransferRecords(domain string) ([]TransferRecord, error) {
+	rows, err := d.db.Query(`
+	SELECT nameserver, name, type, ttl, data FROM zone_transfer_records
+	WHERE domain = ? ORDER BY id`, domain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []TransferRecord
+	for rows.Next() {
+		var rec TransferRecord
+		if err := rows.Scan(&rec.NameServer, &rec.Name, &rec.Type, &rec.TTL, &rec.Data); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
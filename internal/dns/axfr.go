@@ -0,0 +1,269 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+)
+
+// Records accepted from one transfer; bigger zones are cut short
+const maxTransferRecords = 100000
+
+// ErrTransferTruncated is returned, along with the records read so far, when
+// a zone has more than maxTransferRecords records.
+var ErrTransferTruncated = errors.New("dns: zone transfer truncated")
+
+var errNotZoneStart = errors.New("dns: transfer does not start with the zone's SOA")
+
+// TransferZone asks server for zone over TCP, as AXFR (RFC 5936) or as IXFR
+// (RFC 1995) from serial. It returns the zone's records without the SOAs
+// that frame them, then the serial of the zone. An incremental IXFR answer
+// yields only the records added since serial. A server that refuses comes
+// back as an *RcodeError.
+func TransferZone(ctx context.Context, server, zone string, qtype uint16, serial uint32) ([]RR, uint32, error) {
+	query := NewQuery(zone, qtype)
+	query.RecursionDesired = false
+	query.ID = randomID()
+	if qtype == TypeIXFR {
+		query.Authority = []RR{{
+			Name:  Fqdn(zone),
+			Type:  TypeSOA,
+			Class: ClassINET,
+			Data:  &SOA{MName: ".", RName: ".", Serial: serial},
+		}}
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, len(packed)+2), uint16(len(packed)))
+	if _, err := conn.Write(append(framed, packed...)); err != nil {
+		return nil, 0, err
+	}
+
+	x := &transfer{zone: Fqdn(zone), ixfr: qtype == TypeIXFR}
+	for first := true; ; first = false {
+		resp, err := readStreamMsg(conn)
+		if err != nil {
+			return x.records, x.serial, err
+		}
+		// Later messages of a transfer may leave out the question
+		if resp.ID != query.ID || (first && !matches(query, resp)) {
+			return x.records, x.serial, errMismatch
+		}
+		if resp.Rcode != RcodeSuccess {
+			return nil, 0, &RcodeError{Name: zone, Type: qtype, Rcode: resp.Rcode, Server: server}
+		}
+
+		done, err := x.add(resp.Answer)
+		if err != nil || done {
+			return x.records, x.serial, err
+		}
+		// A lone SOA no newer than serial means the IXFR client is up to date
+		if first && x.ixfr && x.seen == 1 && int32(x.serial-serial) <= 0 {
+			return nil, x.serial, nil
+		}
+	}
+}
+
+// transfer follows the records of an AXFR or IXFR answer as they arrive.
+type transfer struct {
+	zone        string
+	ixfr        bool
+	serial      uint32 // Of the opening SOA
+	seen        int
+	incremental bool // IXFR answered with differences rather than the zone
+	adding      bool // Inside the additions of an incremental answer
+	records     []RR
+}
+
+// add takes the next records and reports whether the closing SOA was among
+// them.
+func (x *transfer) add(rrs []RR) (bool, error) {
+	for _, rr := range rrs {
+		x.seen++
+		soa, isSOA := rr.Data.(*SOA)
+
+		if x.seen == 1 {
+			if !isSOA || !strings.EqualFold(rr.Name, x.zone) {
+				return false, errNotZoneStart
+			}
+			x.serial = soa.Serial
+			// The opening SOA counts as the end of an addition segment
+			x.adding = true
+			continue
+		}
+		if x.seen == 2 && x.ixfr && isSOA {
+			x.incremental = true
+		}
+
+		switch {
+		case x.incremental && isSOA:
+			// SOAs alternate between starting deletions and additions; the
+			// new serial where deletions would start closes the answer
+			if x.adding && soa.Serial == x.serial {
+				return true, nil
+			}
+			x.adding = !x.adding
+			continue
+		case isSOA:
+			return true, nil
+		case x.incremental && !x.adding:
+			continue
+		}
+
+		if len(x.records) >= maxTransferRecords {
+			return false, fmt.Errorf("%w after %d records", ErrTransferTruncated, len(x.records))
+		}
+		x.records = append(x.records, rr)
+	}
+	return false, nil
+}
+
+// transferZone asks every address of every name server of domain for a zone
+// transfer: AXFR, then IXFR if AXFR was refused. It returns one attempt per
+// address and the records of the first transfer that was allowed.
+func (r *Resolver) transferZone(domain string, nameServers []string) ([]database.ZoneTransfer, []database.TransferRecord) {
+	timeout := r.config.ZoneTransferTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	port := r.config.ZoneTransferPort
+	if port == 0 {
+		port = 53
+	}
+
+	type target struct{ ns, addr string }
+	var (
+		targets []target
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for _, ns := range nameServers {
+		wg.Add(1)
+		go func(ns string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), r.client.timeout())
+			defer cancel()
+
+			for _, addr := range r.hostAddrs(ctx, ns) {
+				mu.Lock()
+				targets = append(targets, target{ns: ns, addr: addr})
+				mu.Unlock()
+			}
+		}(ns)
+	}
+	wg.Wait()
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].ns != targets[j].ns {
+			return targets[i].ns < targets[j].ns
+		}
+		return targets[i].addr < targets[j].addr
+	})
+
+	attempts := make([]database.ZoneTransfer, len(targets))
+	zones := make([][]RR, len(targets))
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			server := net.JoinHostPort(t.addr, strconv.Itoa(port))
+			a := database.ZoneTransfer{Domain: domain, NameServer: t.ns, Address: t.addr, Method: "AXFR", AttemptedAt: time.Now()}
+			rrs, serial, err := TransferZone(ctx, server, domain, TypeAXFR, 0)
+
+			var rcodeErr *RcodeError
+			if errors.As(err, &rcodeErr) {
+				// Some servers only hand out IXFR; from serial 0 it is the whole zone
+				a.Method = "IXFR"
+				rrs, serial, err = TransferZone(ctx, server, domain, TypeIXFR, 0)
+			}
+
+			if err == nil || errors.Is(err, ErrTransferTruncated) {
+				a.Allowed = true
+				a.Serial = serial
+				a.Records = len(rrs)
+				zones[i] = rrs
+			}
+			if err != nil {
+				a.Error = transferError(err)
+			}
+			attempts[i] = a
+		}(i, t)
+	}
+	wg.Wait()
+
+	for i, rrs := range zones {
+		if len(rrs) == 0 {
+			continue
+		}
+		records := make([]database.TransferRecord, len(rrs))
+		for j, rr := range rrs {
+			records[j] = database.TransferRecord{
+				Name:       strings.TrimSuffix(rr.Name, "."),
+				Type:       TypeString(rr.Type),
+				TTL:        rr.TTL,
+				Data:       rr.Data.String(),
+				NameServer: targets[i].ns,
+			}
+		}
+		return attempts, records
+	}
+	return attempts, nil
+}
+
+// hostAddrs returns the IPv4 and IPv6 addresses of a name server.
+func (r *Resolver) hostAddrs(ctx context.Context, host string) []string {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+
+	var addrs []string
+	for _, qtype := range []uint16{TypeA, TypeAAAA} {
+		resp, _, err := r.lookup(ctx, host, qtype)
+		if err != nil || resp == nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch data := rr.Data.(type) {
+			case *A:
+				addrs = appendUnique(addrs, data.IP.String())
+			case *AAAA:
+				addrs = appendUnique(addrs, data.IP.String())
+			}
+		}
+	}
+	return addrs
+}
+
+// transferError shortens a refusal to its rcode, e.g. REFUSED.
+func transferError(err error) string {
+	var rcodeErr *RcodeError
+	if errors.As(err, &rcodeErr) {
+		return RcodeString(rcodeErr.Rcode)
+	}
+	return err.Error()
+}
@@ -0,0 +1,275 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/recon-scanner/internal/config"
+	"github.com/recon-scanner/internal/database"
+)
+
+// zoneAnswer is how the transfer stand-in answers one zone and query type:
+// an rcode, or the messages of a transfer.
+type zoneAnswer struct {
+	rcode    int
+	messages [][]RR
+}
+
+// transferServer serves zone transfers over TCP on 127.0.0.1, keyed by
+// zone and query type. Anything else is refused.
+func transferServer(t *testing.T, zones map[string]map[uint16]zoneAnswer) (port int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				query, err := readStreamMsg(conn)
+				if err != nil {
+					return
+				}
+				q := query.Question[0]
+				a, ok := zones[strings.TrimSuffix(q.Name, ".")][q.Type]
+				if !ok {
+					a = zoneAnswer{rcode: RcodeRefused}
+				}
+
+				messages := a.messages
+				if a.rcode != RcodeSuccess {
+					messages = [][]RR{nil}
+				}
+				for i, answer := range messages {
+					resp := &Msg{
+						Header: Header{ID: query.ID, Response: true, Authoritative: true, Rcode: a.rcode},
+						Answer: answer,
+					}
+					// Only the first message repeats the question
+					if i == 0 {
+						resp.Question = query.Question
+					}
+					packed, err := resp.Pack()
+					if err != nil {
+						t.Errorf("packing transfer message: %v", err)
+						return
+					}
+					if err := writeFramed(conn, packed); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func soaRR(zone string, serial uint32) RR {
+	return RR{Name: Fqdn(zone), Type: TypeSOA, Class: ClassINET, TTL: 3600, Data: &SOA{
+		MName: "ns1." + Fqdn(zone), RName: "hostmaster." + Fqdn(zone), Serial: serial,
+		Refresh: 7200, Retry: 900, Expire: 1209600, Minimum: 300,
+	}}
+}
+
+func aRR(name string, last byte) RR {
+	return RR{Name: Fqdn(name), Type: TypeA, Class: ClassINET, TTL: 300, Data: &A{IP: net.IPv4(192, 0, 2, last)}}
+}
+
+func txtRR(name, text string) RR {
+	return RR{Name: Fqdn(name), Type: TypeTXT, Class: ClassINET, TTL: 300, Data: &TXT{Strings: []string{text}}}
+}
+
+func transferResolver(port int) *Resolver {
+	return NewHighPerformance(&config.HighPerformanceConfig{
+		Upstreams:           []string{"127.0.0.1:1"},
+		ReadTimeout:         time.Second,
+		ZoneTransfers:       true,
+		ZoneTransferPort:    port,
+		ZoneTransferTimeout: 5 * time.Second,
+	})
+}
+
+func openDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "recon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// storeTransfers runs transferZone for domain against the stand-in and
+// stores the outcome the way ResolveDomain does.
+func storeTransfers(t *testing.T, r *Resolver, db *database.Database, domain string) {
+	t.Helper()
+	attempts, records := r.transferZone(domain, []string{"127.0.0.1"})
+	err := db.SaveDomain(&database.DomainResult{
+		Domain:          domain,
+		ProcessedAt:     time.Now(),
+		ZoneTransfers:   attempts,
+		TransferRecords: records,
+	})
+	if err != nil {
+		t.Fatalf("saving %s: %v", domain, err)
+	}
+}
+
+func findTransfer(t *testing.T, db *database.Database, domain string) database.ZoneTransfer {
+	t.Helper()
+	attempts, err := db.GetZoneTransfers(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []database.ZoneTransfer
+	for _, zt := range attempts {
+		if zt.Domain == domain {
+			found = append(found, zt)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("stored %d transfer attempts for %s, want 1", len(found), domain)
+	}
+	return found[0]
+}
+
+func TestTransferZoneStored(t *testing.T) {
+	port := transferServer(t, map[string]map[uint16]zoneAnswer{
+		"open.test": {TypeAXFR: {messages: [][]RR{
+			{soaRR("open.test", 2024010101), aRR("open.test", 1), aRR("www.open.test", 2)},
+			{txtRR("open.test", "v=spf1 -all")},
+			{aRR("internal.open.test", 3), soaRR("open.test", 2024010101)},
+		}}},
+		// AXFR is turned away; IXFR from serial 0 is the whole zone
+		"ixfr.test": {
+			TypeAXFR: {rcode: RcodeNotImp},
+			TypeIXFR: {messages: [][]RR{
+				{soaRR("ixfr.test", 7), aRR("db.ixfr.test", 4), soaRR("ixfr.test", 7)},
+			}},
+		},
+	})
+	r := transferResolver(port)
+	db := openDatabase(t)
+
+	for _, domain := range []string{"open.test", "closed.test", "ixfr.test"} {
+		storeTransfers(t, r, db, domain)
+	}
+
+	open := findTransfer(t, db, "open.test")
+	if !open.Allowed || open.Method != "AXFR" || open.Serial != 2024010101 || open.Records != 4 || open.Error != "" {
+		t.Errorf("open.test attempt = %+v", open)
+	}
+	if open.NameServer != "127.0.0.1" || open.Address != "127.0.0.1" {
+		t.Errorf("open.test attempt server = %s at %s", open.NameServer, open.Address)
+	}
+	records, err := db.GetTransferRecords("open.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rec := range records {
+		got = append(got, fmt.Sprintf("%s %s %s", rec.Name, rec.Type, rec.Data))
+	}
+	want := []string{
+		"open.test A 192.0.2.1",
+		"www.open.test A 192.0.2.2",
+		"open.test TXT v=spf1 -all",
+		"internal.open.test A 192.0.2.3",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("open.test records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	closed := findTransfer(t, db, "closed.test")
+	if closed.Allowed || closed.Error != "REFUSED" || closed.Records != 0 {
+		t.Errorf("closed.test attempt = %+v", closed)
+	}
+	if records, _ := db.GetTransferRecords("closed.test"); len(records) != 0 {
+		t.Errorf("closed.test stored %d records", len(records))
+	}
+
+	ixfr := findTransfer(t, db, "ixfr.test")
+	if !ixfr.Allowed || ixfr.Method != "IXFR" || ixfr.Serial != 7 || ixfr.Records != 1 {
+		t.Errorf("ixfr.test attempt = %+v", ixfr)
+	}
+	if records, _ := db.GetTransferRecords("ixfr.test"); len(records) != 1 || records[0].Name != "db.ixfr.test" {
+		t.Errorf("ixfr.test records = %+v", records)
+	}
+
+	allowed, err := db.GetZoneTransfers(true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed) != 2 {
+		t.Errorf("%d allowed transfers stored, want 2", len(allowed))
+	}
+}
+
+func TestTransferZoneIncremental(t *testing.T) {
+	// Serial 5 to 6: drop old.inc.test, add new.inc.test
+	port := transferServer(t, map[string]map[uint16]zoneAnswer{
+		"inc.test": {TypeIXFR: {messages: [][]RR{
+			{soaRR("inc.test", 6), soaRR("inc.test", 5), aRR("old.inc.test", 1)},
+			{soaRR("inc.test", 6), aRR("new.inc.test", 2), soaRR("inc.test", 6)},
+		}}},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rrs, serial, err := TransferZone(ctx, fmt.Sprintf("127.0.0.1:%d", port), "inc.test", TypeIXFR, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != 6 || len(rrs) != 1 || rrs[0].Name != "new.inc.test." {
+		t.Errorf("incremental transfer = serial %d, %v", serial, rrs)
+	}
+}
+
+func TestTransferZoneTruncated(t *testing.T) {
+	const perMessage = 2000
+	var messages [][]RR
+	batch := []RR{soaRR("big.test", 1)}
+	for i := 0; i <= maxTransferRecords; i++ {
+		batch = append(batch, aRR(fmt.Sprintf("h%d.big.test", i), byte(i)))
+		if len(batch) == perMessage {
+			messages = append(messages, batch)
+			batch = nil
+		}
+	}
+	messages = append(messages, append(batch, soaRR("big.test", 1)))
+
+	port := transferServer(t, map[string]map[uint16]zoneAnswer{
+		"big.test": {TypeAXFR: {messages: messages}},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rrs, serial, err := TransferZone(ctx, fmt.Sprintf("127.0.0.1:%d", port), "big.test", TypeAXFR, 0)
+	if !errors.Is(err, ErrTransferTruncated) {
+		t.Fatalf("error = %v, want ErrTransferTruncated", err)
+	}
+	if len(rrs) != maxTransferRecords || serial != 1 {
+		t.Errorf("truncated transfer kept %d records at serial %d", len(rrs), serial)
+	}
+
+	// A truncated zone still counts as transferred
+	db := openDatabase(t)
+	storeTransfers(t, transferResolver(port), db, "big.test")
+	zt := findTransfer(t, db, "big.test")
+	if !zt.Allowed || zt.Records != maxTransferRecords || !strings.Contains(zt.Error, "truncated") {
+		t.Errorf("big.test attempt = %+v", zt)
+	}
+}
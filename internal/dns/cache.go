@@ -0,0 +1,264 @@
+package dns
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rough per-entry bookkeeping on top of the records: map slot, list element,
+// message header and slices.
+const (
+	cacheEntryOverhead = 256
+	cacheRROverhead    = 64
+)
+
+// CacheOptions bound what a Cache keeps and for how long.
+type CacheOptions struct {
+	MaxBytes       int64         // Estimated memory held by entries
+	MaxTTL         time.Duration // Ceiling for positive answers
+	MaxNegativeTTL time.Duration // Ceiling for NXDOMAIN and NODATA, RFC 2308 section 5
+}
+
+// CacheStats counts cache use since start.
+type CacheStats struct {
+	Hits         int64
+	NegativeHits int64 // Included in Hits
+	Misses       int64
+	Evictions    int64 // Entries dropped to stay under MaxBytes
+	Entries      int
+	Bytes        int64
+}
+
+type noCacheKey struct{}
+
+// withoutCache marks ctx so that queries made with it neither read nor fill
+// the cache, for one-off names such as wildcard probes that would only push
+// useful answers out.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cacheFor(ctx context.Context, c *Cache) *Cache {
+	if ctx.Value(noCacheKey{}) != nil {
+		return nil
+	}
+	return c
+}
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	msg      *Msg
+	stored   time.Time
+	expires  time.Time
+	negative bool
+	size     int64
+}
+
+// Cache keeps NOERROR and NXDOMAIN responses by (name, type) until their TTL
+// runs out, evicting the least recently used when over its memory budget.
+// Negative answers are kept for the SOA minimum of the authority section and
+// not at all without one, as RFC 2308 asks.
+type Cache struct {
+	opts CacheOptions
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List // Front is most recently used
+	bytes   int64
+	stats   CacheStats
+}
+
+func NewCache(opts CacheOptions) *Cache {
+	return &Cache{
+		opts:    opts,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns a cached response with TTLs lowered by the time it spent in
+// the cache, or nil.
+func (c *Cache) Get(name string, qtype uint16) *Msg {
+	key := cacheKey{name: strings.ToLower(Fqdn(name)), qtype: qtype}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.remove(el)
+		c.stats.Misses++
+		return nil
+	}
+
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	if entry.negative {
+		c.stats.NegativeHits++
+	}
+	return aged(entry.msg, uint32(now.Sub(entry.stored)/time.Second))
+}
+
+// Put stores resp if it is cacheable: NOERROR or NXDOMAIN, not truncated and
+// with a non-zero TTL.
+func (c *Cache) Put(name string, qtype uint16, resp *Msg) {
+	if resp == nil || resp.Truncated || (resp.Rcode != RcodeSuccess && resp.Rcode != RcodeNXDomain) {
+		return
+	}
+
+	negative := resp.Rcode == RcodeNXDomain || len(resp.Answer) == 0
+	var ttl time.Duration
+	if negative {
+		ttl = negativeTTL(resp)
+		if ttl > c.opts.MaxNegativeTTL {
+			ttl = c.opts.MaxNegativeTTL
+		}
+	} else {
+		ttl = answerTTL(resp)
+		if ttl > c.opts.MaxTTL {
+			ttl = c.opts.MaxTTL
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{
+		key:      cacheKey{name: strings.ToLower(Fqdn(name)), qtype: qtype},
+		msg:      resp,
+		stored:   now,
+		expires:  now.Add(ttl),
+		negative: negative,
+		size:     msgSize(resp),
+	}
+	if entry.size > c.opts.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[entry.key]; ok {
+		c.remove(el)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+
+	for c.bytes > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Shrink evicts least recently used entries until at most fraction of the
+// budget is used, e.g. under memory pressure.
+func (c *Cache) Shrink(fraction float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := int64(float64(c.opts.MaxBytes) * fraction)
+	for c.bytes > target && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func (c *Cache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// answerTTL is the lowest TTL in the answer section, CNAMEs included.
+func answerTTL(resp *Msg) time.Duration {
+	ttl := resp.Answer[0].TTL
+	for _, rr := range resp.Answer[1:] {
+		if rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// negativeTTL is the lower of the SOA record's TTL and its MINIMUM field,
+// RFC 2308 section 5. Without an SOA the answer is not cached.
+func negativeTTL(resp *Msg) time.Duration {
+	for _, rr := range resp.Authority {
+		if soa, ok := rr.Data.(*SOA); ok {
+			ttl := rr.TTL
+			if soa.Minimum < ttl {
+				ttl = soa.Minimum
+			}
+			return time.Duration(ttl) * time.Second
+		}
+	}
+	return 0
+}
+
+// aged copies msg with every TTL lowered by age seconds. Record data is
+// shared, so callers must not modify it.
+func aged(msg *Msg, age uint32) *Msg {
+	cp := *msg
+	cp.Answer = agedRRs(msg.Answer, age)
+	cp.Authority = agedRRs(msg.Authority, age)
+	cp.Additional = agedRRs(msg.Additional, age)
+	return &cp
+}
+
+func agedRRs(rrs []RR, age uint32) []RR {
+	if rrs == nil {
+		return nil
+	}
+	out := make([]RR, len(rrs))
+	for i, rr := range rrs {
+		if rr.TTL > age {
+			rr.TTL -= age
+		} else {
+			rr.TTL = 0
+		}
+		out[i] = rr
+	}
+	return out
+}
+
+// msgSize estimates the memory held by a cached response.
+func msgSize(msg *Msg) int64 {
+	size := int64(cacheEntryOverhead)
+	for _, q := range msg.Question {
+		size += int64(len(q.Name))
+	}
+	for _, section := range [][]RR{msg.Answer, msg.Authority, msg.Additional} {
+		for _, rr := range section {
+			size += cacheRROverhead + int64(len(rr.Name))
+			if packed, err := rr.Data.pack(nil); err == nil {
+				size += int64(len(packed))
+			}
+		}
+	}
+	return size
+}
@@ -0,0 +1,303 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Advertised EDNS0 buffer; 1232 avoids IP fragmentation on common paths
+const DefaultUDPSize = 1232
+
+const (
+	defaultQueryTimeout = 5 * time.Second
+	defaultAttempts     = 3
+	resolvConfPath      = "/etc/resolv.conf"
+)
+
+// Used when resolv.conf lists no name servers
+var fallbackServers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+// RcodeError reports a response whose rcode is not NOERROR.
+type RcodeError struct {
+	Name   string
+	Type   uint16
+	Rcode  int
+	Server string
+}
+
+func (e *RcodeError) Error() string {
+	if e.Server == "" {
+		return fmt.Sprintf("%s %s: %s", TypeString(e.Type), e.Name, RcodeString(e.Rcode))
+	}
+	return fmt.Sprintf("%s %s from %s: %s", TypeString(e.Type), e.Name, e.Server, RcodeString(e.Rcode))
+}
+
+var errMismatch = errors.New("dns: response does not match query")
+
+// Client sends queries over UDP, falling back to TCP for truncated answers,
+// or over DoT and DoH to upstreams configured that way. Every UDP query uses
+// a fresh socket, so the kernel picks a random source port, and a random ID
+// from crypto/rand.
+type Client struct {
+	Upstreams *UpstreamPool
+	Timeout   time.Duration // Per exchange
+	Attempts  int           // Exchanges before giving up, each to the next upstream
+	UDPSize   uint16
+	Cache     *Cache // Optional
+	DNSSEC    bool   // Set DO and CD so answers carry RRSIGs and bogus data is still returned
+}
+
+func NewClient(upstreams *UpstreamPool, timeout time.Duration, attempts int) *Client {
+	return &Client{
+		Upstreams: upstreams,
+		Timeout:   timeout,
+		Attempts:  attempts,
+		UDPSize:   DefaultUDPSize,
+	}
+}
+
+// SystemServers reads the name servers from /etc/resolv.conf.
+func SystemServers() []string {
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return fallbackServers
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, withDefaultPort(fields[1]))
+		}
+	}
+	if len(servers) == 0 {
+		return fallbackServers
+	}
+	return servers
+}
+
+// withDefaultPort adds port 53 to a bare address.
+func withDefaultPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+}
+
+// Query asks the upstreams for name and qtype. A response with a failing
+// rcode is returned together with an *RcodeError; SERVFAIL and REFUSED move
+// on to the next upstream first. Answers are served from and added to the
+// cache, if there is one and ctx allows it.
+func (c *Client) Query(ctx context.Context, name string, qtype uint16) (*Msg, error) {
+	cache := cacheFor(ctx, c.Cache)
+	if cache != nil {
+		if resp := cache.Get(name, qtype); resp != nil {
+			if resp.Rcode == RcodeNXDomain {
+				return resp, &RcodeError{Name: name, Type: qtype, Rcode: resp.Rcode}
+			}
+			return resp, nil
+		}
+	}
+
+	attempts := c.Attempts
+	if attempts <= 0 {
+		attempts = defaultAttempts
+	}
+
+	var (
+		resp    *Msg
+		server  string
+		lastErr error
+	)
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+
+		u, err := c.Upstreams.pick(ctx)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		server = u.addr
+
+		query := NewQuery(name, qtype)
+		query.EDNS = &EDNS{UDPSize: c.udpSize(), DNSSEC: c.DNSSEC}
+		query.CheckingDisabled = c.DNSSEC
+
+		start := time.Now()
+		resp, lastErr = c.exchangeVia(ctx, u, query)
+		c.Upstreams.report(u, time.Since(start), resp, lastErr)
+		if lastErr != nil {
+			continue
+		}
+
+		if resp.Rcode == RcodeSuccess || resp.Rcode == RcodeNXDomain {
+			break
+		}
+		lastErr = &RcodeError{Name: name, Type: qtype, Rcode: resp.Rcode, Server: server}
+		if resp.Rcode != RcodeServFail && resp.Rcode != RcodeRefused {
+			break
+		}
+	}
+
+	if cache != nil && lastErr == nil {
+		cache.Put(name, qtype, resp)
+	}
+	if resp != nil && resp.Rcode == RcodeNXDomain {
+		return resp, &RcodeError{Name: name, Type: qtype, Rcode: resp.Rcode, Server: server}
+	}
+	if lastErr == nil && resp == nil {
+		lastErr = ctx.Err()
+	}
+	return resp, lastErr
+}
+
+// exchangeVia sends query to u over its transport: plain DNS, DoT or DoH.
+func (c *Client) exchangeVia(ctx context.Context, u *upstream, query *Msg) (*Msg, error) {
+	if u.transport == nil {
+		return c.Exchange(ctx, u.addr, query)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+	return u.transport.exchange(ctx, query)
+}
+
+// Exchange sends one query to server and waits for the matching response.
+// Truncated UDP responses are retried over TCP.
+func (c *Client) Exchange(ctx context.Context, server string, query *Msg) (*Msg, error) {
+	query.ID = randomID()
+
+	resp, err := c.exchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated {
+		return c.exchange(ctx, "tcp", server, query)
+	}
+	return resp, nil
+}
+
+func (c *Client) exchange(ctx context.Context, network, server string, query *Msg) (*Msg, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if network == "tcp" {
+		return exchangeStream(conn, packed, query)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, c.udpSize())
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		// Ignore stray or spoofed packets and keep waiting for ours
+		resp := new(Msg)
+		if err := resp.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		if matches(query, resp) {
+			return resp, nil
+		}
+	}
+}
+
+// exchangeStream sends a query over a stream connection with the two-byte
+// length prefix of RFC 1035 section 4.2.2.
+func exchangeStream(conn net.Conn, packed []byte, query *Msg) (*Msg, error) {
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, len(packed)+2), uint16(len(packed)))
+	if _, err := conn.Write(append(framed, packed...)); err != nil {
+		return nil, err
+	}
+
+	resp, err := readStreamMsg(conn)
+	if err != nil {
+		return nil, err
+	}
+	if !matches(query, resp) {
+		return nil, errMismatch
+	}
+	return resp, nil
+}
+
+func readStreamMsg(r io.Reader) (*Msg, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	resp := new(Msg)
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func matches(query, resp *Msg) bool {
+	if !resp.Response || resp.ID != query.ID {
+		return false
+	}
+	// FORMERR and NOTIMP replies may omit the question
+	if len(resp.Question) == 0 {
+		return resp.Rcode != RcodeSuccess
+	}
+	q, r := query.Question[0], resp.Question[0]
+	return q.Type == r.Type && q.Class == r.Class && strings.EqualFold(q.Name, r.Name)
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultQueryTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) udpSize() uint16 {
+	if c.UDPSize < 512 {
+		return DefaultUDPSize
+	}
+	return c.UDPSize
+}
+
+func randomID() uint16 {
+	var b [2]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
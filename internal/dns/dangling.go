@@ -0,0 +1,167 @@
+package dns
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+)
+
+// Longest CNAME chain followed before giving up on a loop
+const maxCNAMEHops = 16
+
+// Bytes of a page read when looking for a fingerprint
+const maxFingerprintBody = 64 * 1024
+
+//go:embed fingerprints.json
+var defaultFingerprints []byte
+
+// Fingerprint recognises a hosting provider by the CNAME targets it hands
+// out and, optionally, by what it serves for names nobody has claimed.
+type Fingerprint struct {
+	Service string   `json:"service"`
+	CNAME   []string `json:"cname"`          // Target suffixes, e.g. ".github.io"
+	Body    string   `json:"body,omitempty"` // Page text shown for unclaimed names
+}
+
+// LoadFingerprints reads fingerprints from a JSON file, or returns the
+// built-in set when path is empty.
+func LoadFingerprints(path string) ([]Fingerprint, error) {
+	data := defaultFingerprints
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var fingerprints []Fingerprint
+	if err := json.Unmarshal(data, &fingerprints); err != nil {
+		return nil, fmt.Errorf("invalid fingerprint file %s: %w", path, err)
+	}
+	return fingerprints, nil
+}
+
+// DanglingDetector flags CNAME chains that end in a name that does not
+// exist, or at a provider that serves its "nothing here" page.
+type DanglingDetector struct {
+	fingerprints []Fingerprint
+	client       *http.Client // nil disables the page checks
+}
+
+// NewDanglingDetector returns a detector. A zero httpTimeout skips fetching
+// pages, so only chains ending in NXDOMAIN are flagged. Redirects are not
+// followed: only the page the domain itself serves can match.
+func NewDanglingDetector(fingerprints []Fingerprint, httpTimeout time.Duration) *DanglingDetector {
+	d := &DanglingDetector{fingerprints: fingerprints}
+	if httpTimeout > 0 {
+		d.client = &http.Client{
+			Timeout: httpTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return d
+}
+
+// Check examines the chain of domain. nxdomain says the final target does
+// not exist; addrs are the addresses the chain resolved to.
+func (d *DanglingDetector) Check(domain string, chain []string, nxdomain bool, addrs []string) *database.DanglingCNAME {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	target := chain[len(chain)-1]
+	fp := d.match(chain)
+
+	finding := &database.DanglingCNAME{
+		Domain:     domain,
+		Chain:      chain,
+		Target:     target,
+		DetectedAt: time.Now(),
+	}
+	if fp != nil {
+		finding.Service = fp.Service
+	}
+
+	if nxdomain {
+		finding.Reason = fmt.Sprintf("CNAME target %s does not exist", target)
+		return finding
+	}
+
+	if fp == nil || fp.Body == "" || len(addrs) == 0 || d.client == nil {
+		return nil
+	}
+	if d.pageContains(domain, addrs[0], fp.Body) {
+		finding.Reason = fmt.Sprintf("%s serves its unclaimed page: %q", fp.Service, fp.Body)
+		return finding
+	}
+	return nil
+}
+
+// match returns the fingerprint of the first provider found along the chain.
+func (d *DanglingDetector) match(chain []string) *Fingerprint {
+	for _, name := range chain {
+		name = "." + strings.ToLower(name)
+		for i := range d.fingerprints {
+			for _, suffix := range d.fingerprints[i].CNAME {
+				if strings.HasSuffix(name, strings.ToLower(suffix)) {
+					return &d.fingerprints[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pageContains fetches the page domain serves from addr, which was resolved
+// through the scanner's own upstreams rather than the system resolver.
+func (d *DanglingDetector) pageContains(domain, addr, text string) bool {
+	req, err := http.NewRequest(http.MethodGet, "http://"+net.JoinHostPort(addr, "80")+"/", nil)
+	if err != nil {
+		return false
+	}
+	req.Host = domain
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFingerprintBody))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(body), text)
+}
+
+// followCNAMEs returns the CNAME targets in answer, starting at owner.
+func followCNAMEs(owner string, answer []RR) []string {
+	targets := make(map[string]string)
+	for _, rr := range answer {
+		if cname, ok := rr.Data.(*CNAME); ok {
+			targets[strings.ToLower(rr.Name)] = cname.Target
+		}
+	}
+
+	var chain []string
+	name := strings.ToLower(Fqdn(owner))
+	for len(chain) < maxCNAMEHops {
+		target, ok := targets[name]
+		if !ok {
+			break
+		}
+		chain = append(chain, strings.TrimSuffix(target, "."))
+		name = strings.ToLower(target)
+	}
+	return chain
+}
@@ -0,0 +1,374 @@
+package dns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DNSSEC algorithm numbers
+const (
+	AlgRSASHA1         uint8 = 5
+	AlgRSASHA1NSEC3    uint8 = 7
+	AlgRSASHA256       uint8 = 8
+	AlgRSASHA512       uint8 = 10
+	AlgECDSAP256SHA256 uint8 = 13
+	AlgECDSAP384SHA384 uint8 = 14
+	AlgED25519         uint8 = 15
+)
+
+// DS digest types
+const (
+	DigestSHA1   uint8 = 1
+	DigestSHA256 uint8 = 2
+	DigestSHA384 uint8 = 4
+)
+
+const (
+	dnskeyFlagZone = 0x0100
+	nsec3OptOut    = 0x01
+	nsec3HashSHA1  = 1
+)
+
+var errNoSignature = errors.New("no RRSIG")
+
+// supportedAlgorithm reports whether signatures of alg can be verified.
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case AlgRSASHA1, AlgRSASHA1NSEC3, AlgRSASHA256, AlgRSASHA512,
+		AlgECDSAP256SHA256, AlgECDSAP384SHA384, AlgED25519:
+		return true
+	}
+	return false
+}
+
+// KeyTag computes the tag of RFC 4034 appendix B.
+func (k *DNSKEY) KeyTag() uint16 {
+	rdata, _ := k.pack(nil)
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac)
+}
+
+// matchesDS reports whether key, owned by owner, is the one ds refers to.
+func matchesDS(owner string, key *DNSKEY, ds *DS) bool {
+	if key.Algorithm != ds.Algorithm || key.KeyTag() != ds.KeyTag {
+		return false
+	}
+
+	data, err := packName(nil, strings.ToLower(owner))
+	if err != nil {
+		return false
+	}
+	if data, err = key.pack(data); err != nil {
+		return false
+	}
+
+	var digest []byte
+	switch ds.DigestType {
+	case DigestSHA1:
+		sum := sha1.Sum(data)
+		digest = sum[:]
+	case DigestSHA256:
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	case DigestSHA384:
+		sum := sha512.Sum384(data)
+		digest = sum[:]
+	default:
+		return false
+	}
+	return bytes.Equal(digest, ds.Digest)
+}
+
+// verifyRRset checks that one of sigs over rrset was made by one of keys, the
+// zone keys of signer. It returns why none did.
+func verifyRRset(rrset []RR, sigs []*RRSIG, keys []*DNSKEY, signer string, now time.Time) error {
+	if len(sigs) == 0 {
+		return errNoSignature
+	}
+
+	err := fmt.Errorf("no key of %s matches the RRSIG", signer)
+	for _, sig := range sigs {
+		if !strings.EqualFold(sig.SignerName, signer) {
+			err = fmt.Errorf("signed by %s, not %s", sig.SignerName, signer)
+			continue
+		}
+		if !signatureCurrent(sig, now) {
+			err = fmt.Errorf("RRSIG by key %d is outside its validity period", sig.KeyTag)
+			continue
+		}
+		for _, key := range keys {
+			if key.Flags&dnskeyFlagZone == 0 || key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+				continue
+			}
+			if err = verifySignature(rrset, sig, key); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// signatureCurrent compares times with the serial arithmetic of RFC 4034
+// section 3.1.5, so timestamps past 2106 still work.
+func signatureCurrent(sig *RRSIG, now time.Time) bool {
+	t := uint32(now.Unix())
+	return int32(t-sig.Inception) >= 0 && int32(sig.Expiration-t) >= 0
+}
+
+func verifySignature(rrset []RR, sig *RRSIG, key *DNSKEY) error {
+	data, err := signedData(rrset, sig)
+	if err != nil {
+		return err
+	}
+
+	switch sig.Algorithm {
+	case AlgRSASHA1, AlgRSASHA1NSEC3, AlgRSASHA256, AlgRSASHA512:
+		pub, err := rsaKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		hash := crypto.SHA256
+		switch sig.Algorithm {
+		case AlgRSASHA1, AlgRSASHA1NSEC3:
+			hash = crypto.SHA1
+		case AlgRSASHA512:
+			hash = crypto.SHA512
+		}
+		h := hash.New()
+		h.Write(data)
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig.Signature)
+
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		curve, hash := elliptic.P256(), crypto.SHA256
+		if sig.Algorithm == AlgECDSAP384SHA384 {
+			curve, hash = elliptic.P384(), crypto.SHA384
+		}
+		size := curve.Params().BitSize / 8
+		if len(key.PublicKey) != 2*size || len(sig.Signature) != 2*size {
+			return errors.New("malformed ECDSA key or signature")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		h := hash.New()
+		h.Write(data)
+		r := new(big.Int).SetBytes(sig.Signature[:size])
+		s := new(big.Int).SetBytes(sig.Signature[size:])
+		if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return errors.New("ECDSA signature does not verify")
+		}
+		return nil
+
+	case AlgED25519:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("malformed Ed25519 key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.PublicKey), data, sig.Signature) {
+			return errors.New("Ed25519 signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %d", sig.Algorithm)
+}
+
+// rsaKey decodes the public key format of RFC 3110 section 2.
+func rsaKey(data []byte) (*rsa.PublicKey, error) {
+	if len(data) < 3 {
+		return nil, errors.New("malformed RSA key")
+	}
+	expLen, off := int(data[0]), 1
+	if expLen == 0 {
+		expLen, off = int(binary.BigEndian.Uint16(data[1:])), 3
+	}
+	if expLen > 4 || off+expLen >= len(data) {
+		return nil, errors.New("malformed RSA key")
+	}
+
+	var exp int
+	for _, b := range data[off : off+expLen] {
+		exp = exp<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(data[off+expLen:]), E: exp}, nil
+}
+
+// signedData builds what sig signs: its own rdata without the signature,
+// then the RRset in canonical form and order (RFC 4034 sections 3.1.8.1
+// and 6).
+func signedData(rrset []RR, sig *RRSIG) ([]byte, error) {
+	head := *sig
+	head.SignerName = strings.ToLower(sig.SignerName)
+	head.Signature = nil
+	data, err := head.pack(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([][]byte, 0, len(rrset))
+	for _, rr := range rrset {
+		owner := strings.ToLower(rr.Name)
+		// Answers synthesised from a wildcard are signed as the wildcard
+		if labels := labelCount(owner); labels > int(sig.Labels) {
+			parts := strings.Split(strings.TrimSuffix(owner, "."), ".")
+			owner = "*." + strings.Join(parts[len(parts)-int(sig.Labels):], ".") + "."
+		}
+
+		b, err := packName(nil, owner)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, rr.Type)
+		b = binary.BigEndian.AppendUint16(b, rr.Class)
+		b = binary.BigEndian.AppendUint32(b, sig.OrigTTL)
+
+		lengthAt := len(b)
+		b = append(b, 0, 0)
+		if b, err = canonicalRData(rr.Data).pack(b); err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(b[lengthAt:], uint16(len(b)-lengthAt-2))
+		records = append(records, b)
+	}
+
+	// Owner, type and class are equal, so sorting whole records sorts by rdata
+	sort.Slice(records, func(i, j int) bool { return bytes.Compare(records[i], records[j]) < 0 })
+	for i, rec := range records {
+		if i > 0 && bytes.Equal(rec, records[i-1]) {
+			continue
+		}
+		data = append(data, rec...)
+	}
+	return data, nil
+}
+
+// canonicalRData lower-cases the names inside the rdata types that RFC 4034
+// section 6.2 (as amended by RFC 6840) lists.
+func canonicalRData(data RData) RData {
+	switch d := data.(type) {
+	case *NS:
+		return &NS{Host: strings.ToLower(d.Host)}
+	case *CNAME:
+		return &CNAME{Target: strings.ToLower(d.Target)}
+	case *PTR:
+		return &PTR{Host: strings.ToLower(d.Host)}
+	case *MX:
+		return &MX{Preference: d.Preference, Host: strings.ToLower(d.Host)}
+	case *SOA:
+		soa := *d
+		soa.MName, soa.RName = strings.ToLower(d.MName), strings.ToLower(d.RName)
+		return &soa
+	case *SRV:
+		srv := *d
+		srv.Target = strings.ToLower(d.Target)
+		return &srv
+	case *RRSIG:
+		sig := *d
+		sig.SignerName = strings.ToLower(d.SignerName)
+		return &sig
+	}
+	return data
+}
+
+// labelCount counts the labels of a name the way the RRSIG Labels field
+// does: without the root and without a leading wildcard.
+func labelCount(name string) int {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return 0
+	}
+	n := strings.Count(name, ".") + 1
+	if strings.HasPrefix(name, "*.") {
+		n--
+	}
+	return n
+}
+
+// nsec3Hash hashes name with the parameters of an NSEC3 record, RFC 5155
+// section 5.
+func nsec3Hash(name string, salt []byte, iterations uint16) []byte {
+	wire, err := packName(nil, strings.ToLower(Fqdn(name)))
+	if err != nil {
+		return nil
+	}
+	h := sha1.Sum(append(wire, salt...))
+	for i := 0; i < int(iterations); i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return h[:]
+}
+
+// nsec3Covers reports whether hash falls strictly between the owner hash and
+// the next hashed owner, wrapping around at the end of the chain.
+func nsec3Covers(owner, next, hash []byte) bool {
+	if bytes.Compare(owner, next) < 0 {
+		return bytes.Compare(owner, hash) < 0 && bytes.Compare(hash, next) < 0
+	}
+	return bytes.Compare(owner, hash) < 0 || bytes.Compare(hash, next) < 0
+}
+
+func hasBitmapType(types []uint16, t uint16) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// rrsets groups the records of a section by owner and type, with the RRSIGs
+// that cover each group.
+type rrset struct {
+	name  string // Lower case
+	rtype uint16
+	rrs   []RR
+	sigs  []*RRSIG
+}
+
+func groupRRsets(rrs []RR) []*rrset {
+	var sets []*rrset
+	find := func(name string, rtype uint16) *rrset {
+		for _, s := range sets {
+			if s.name == name && s.rtype == rtype {
+				return s
+			}
+		}
+		s := &rrset{name: name, rtype: rtype}
+		sets = append(sets, s)
+		return s
+	}
+
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Name)
+		if sig, ok := rr.Data.(*RRSIG); ok {
+			s := find(name, sig.TypeCovered)
+			s.sigs = append(s.sigs, sig)
+			continue
+		}
+		s := find(name, rr.Type)
+		s.rrs = append(s.rrs, rr)
+	}
+	return sets
+}
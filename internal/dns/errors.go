@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Error classes stored alongside results and used to decide on retries
+const (
+	ErrorClassNXDomain    = "nxdomain"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassServFail    = "servfail"
+	ErrorClassUnreachable = "unreachable"
+	ErrorClassTemporary   = "temporary"
+	ErrorClassOther       = "error"
+)
+
+// ClassifyError reduces a lookup error to a short class stored alongside results.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorClassUnreachable
+	}
+
+	var rcodeErr *RcodeError
+	if errors.As(err, &rcodeErr) {
+		switch rcodeErr.Rcode {
+		case RcodeNXDomain:
+			return ErrorClassNXDomain
+		case RcodeServFail:
+			return ErrorClassServFail
+		}
+		return ErrorClassOther
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return ErrorClassNXDomain
+		case dnsErr.IsTimeout:
+			return ErrorClassTimeout
+		case dnsErr.Err == "server misbehaving":
+			return ErrorClassServFail
+		case dnsErr.IsTemporary:
+			return ErrorClassTemporary
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	return ErrorClassOther
+}
+
+// IsRetryable reports whether a failed lookup may succeed if tried again.
+// NXDOMAIN is an answer, not a failure, and is never retried.
+func IsRetryable(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassTimeout, ErrorClassServFail, ErrorClassUnreachable, ErrorClassTemporary:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,443 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Referrals followed for one name before giving up
+	maxReferrals = 32
+
+	// Nesting of lookups for name server addresses that came without glue
+	maxGlueDepth = 4
+
+	// Delegations kept before expired ones are swept out
+	maxDelegations = 100000
+
+	minDelegationTTL = time.Minute
+	maxDelegationTTL = 24 * time.Hour
+)
+
+//go:embed named.root
+var rootHints []byte
+
+type nameserver struct {
+	host  string   // Lower case, fully qualified
+	addrs []string // host:port, IPv4 first
+}
+
+type delegation struct {
+	zone    string
+	servers []nameserver
+	expires time.Time
+}
+
+// Lame is a name server that is delegated a zone but did not answer for it.
+type Lame struct {
+	Zone   string
+	Server string
+	Reason string
+}
+
+func (l Lame) String() string {
+	zone := l.Zone
+	if zone != "." {
+		zone = strings.TrimSuffix(zone, ".")
+	}
+	return fmt.Sprintf("%s for %s: %s", l.Server, zone, l.Reason)
+}
+
+// Trace tells how an iterative lookup was answered.
+type Trace struct {
+	Server string // "host (address)" of the authoritative server that answered
+	Lame   []Lame
+}
+
+// Iterator resolves names without a recursive resolver: it starts at the
+// root servers from the embedded hints, follows referrals down to the
+// authoritative servers and caches the delegations it learns on the way.
+type Iterator struct {
+	client *Client // Used for Exchange and its answer cache; its upstreams are not
+	roots  *delegation
+
+	mu          sync.RWMutex
+	delegations map[string]*delegation
+}
+
+func NewIterator(client *Client) *Iterator {
+	return &Iterator{
+		client:      client,
+		roots:       parseRootHints(rootHints),
+		delegations: make(map[string]*delegation),
+	}
+}
+
+// Query resolves name and qtype, following CNAMEs. Like Client.Query, a
+// response with a failing rcode comes with an *RcodeError.
+func (it *Iterator) Query(ctx context.Context, name string, qtype uint16) (*Msg, *Trace, error) {
+	trace := &Trace{}
+	resp, err := it.query(ctx, strings.ToLower(Fqdn(name)), qtype, trace, 0)
+	if err != nil {
+		return nil, trace, err
+	}
+	if resp.Rcode != RcodeSuccess {
+		return resp, trace, &RcodeError{Name: name, Type: qtype, Rcode: resp.Rcode, Server: trace.Server}
+	}
+	return resp, trace, nil
+}
+
+// query answers from the cache or resolves and caches. Lookups made on the
+// way, such as name server addresses, are cached even when ctx skips the
+// cache for name itself.
+func (it *Iterator) query(ctx context.Context, name string, qtype uint16, trace *Trace, depth int) (*Msg, error) {
+	cache := it.client.Cache
+	if depth == 0 {
+		cache = cacheFor(ctx, cache)
+	}
+	if cache != nil {
+		if resp := cache.Get(name, qtype); resp != nil {
+			return resp, nil
+		}
+	}
+
+	resp, err := it.resolve(ctx, name, qtype, trace, depth)
+	if err == nil && cache != nil {
+		cache.Put(name, qtype, resp)
+	}
+	return resp, err
+}
+
+// resolve follows the CNAME chain of name, putting every hop in the answer
+// of the final response as a recursive resolver would.
+func (it *Iterator) resolve(ctx context.Context, name string, qtype uint16, trace *Trace, depth int) (*Msg, error) {
+	var chain []RR
+	for hops := 0; ; hops++ {
+		resp, server, err := it.follow(ctx, name, qtype, trace, depth)
+		if err != nil {
+			return nil, err
+		}
+		trace.Server = server
+
+		targets := followCNAMEs(name, resp.Answer)
+		end := name
+		if len(targets) > 0 {
+			end = strings.ToLower(Fqdn(targets[len(targets)-1]))
+		}
+		if qtype == TypeCNAME || end == name || hasType(resp.Answer, end, qtype) ||
+			resp.Rcode != RcodeSuccess || hops >= maxCNAMEHops {
+			out := *resp
+			out.Answer = append(chain, resp.Answer...)
+			return &out, nil
+		}
+
+		// The server only knew the first hops; ask for the rest where it lives
+		chain = append(chain, resp.Answer...)
+		name = end
+	}
+}
+
+// follow walks referrals from the closest known delegation of name until a
+// server answers. server is who answered.
+func (it *Iterator) follow(ctx context.Context, name string, qtype uint16, trace *Trace, depth int) (*Msg, string, error) {
+	// DS records live in the parent zone, RFC 4035 section 3.1.4.1
+	start := name
+	if qtype == TypeDS && name != "." {
+		start = parentZone(name)
+	}
+	d := it.closest(start)
+	for i := 0; i < maxReferrals; i++ {
+		resp, server, next, err := it.ask(ctx, d, name, qtype, trace, depth)
+		if err != nil || next == nil {
+			return resp, server, err
+		}
+		it.remember(next)
+		d = next
+	}
+	return nil, "", fmt.Errorf("dns: too many referrals resolving %s", name)
+}
+
+// ask tries the servers of d until one answers or refers further down.
+// Servers that refuse, fail or answer without authority are recorded as lame.
+// When every server is lame a SERVFAIL response is made up.
+func (it *Iterator) ask(ctx context.Context, d *delegation, name string, qtype uint16, trace *Trace, depth int) (*Msg, string, *delegation, error) {
+	var (
+		responded bool
+		lastErr   error
+	)
+
+	var start int
+	if len(d.servers) > 0 {
+		start = rand.Intn(len(d.servers))
+	}
+	for i := range d.servers {
+		ns := d.servers[(start+i)%len(d.servers)]
+
+		addrs := ns.addrs
+		if len(addrs) == 0 {
+			addrs = it.addrsOf(ctx, ns.host, d.zone, depth)
+		}
+		if len(addrs) == 0 {
+			trace.lame(d.zone, ns.host, "no address")
+			continue
+		}
+
+		for _, addr := range addrs {
+			server := serverName(ns.host, addr)
+
+			query := NewQuery(name, qtype)
+			query.RecursionDesired = false
+			query.EDNS = &EDNS{UDPSize: it.client.udpSize(), DNSSEC: it.client.DNSSEC}
+
+			resp, err := it.client.Exchange(ctx, addr, query)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, "", nil, ctx.Err()
+				}
+				lastErr = err
+				trace.lame(d.zone, server, "no response: "+ClassifyError(err))
+				continue
+			}
+			responded = true
+
+			if resp.Rcode != RcodeSuccess && resp.Rcode != RcodeNXDomain {
+				trace.lame(d.zone, server, RcodeString(resp.Rcode))
+				break
+			}
+
+			if resp.Rcode == RcodeNXDomain || len(resp.Answer) > 0 {
+				return resp, server, nil, nil
+			}
+			if next := referral(resp, d.zone, name); next != nil {
+				return nil, server, next, nil
+			}
+			if resp.Authoritative {
+				return resp, server, nil, nil
+			}
+			trace.lame(d.zone, server, "not authoritative")
+			break
+		}
+	}
+
+	if !responded && lastErr != nil {
+		return nil, "", nil, lastErr
+	}
+	resp := &Msg{Question: []Question{{Name: name, Type: qtype, Class: ClassINET}}}
+	resp.Response, resp.Rcode = true, RcodeServFail
+	return resp, "", nil, nil
+}
+
+// addrsOf resolves the address of a name server that came without glue.
+// A server inside the zone it serves cannot be found without glue.
+func (it *Iterator) addrsOf(ctx context.Context, host, zone string, depth int) []string {
+	if depth >= maxGlueDepth || isSubdomain(host, zone) {
+		return nil
+	}
+
+	var addrs []string
+	for _, qtype := range []uint16{TypeA, TypeAAAA} {
+		resp, err := it.query(ctx, host, qtype, &Trace{}, depth+1)
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch data := rr.Data.(type) {
+			case *A:
+				addrs = append(addrs, net.JoinHostPort(data.IP.String(), "53"))
+			case *AAAA:
+				addrs = append(addrs, net.JoinHostPort(data.IP.String(), "53"))
+			}
+		}
+	}
+	return addrs
+}
+
+// referral returns the delegation in resp if it points below zone and toward
+// name. Glue is only taken for servers inside zone, which the answering
+// server is authoritative for.
+func referral(resp *Msg, zone, name string) *delegation {
+	next := &delegation{}
+	var ttl uint32
+	for _, rr := range resp.Authority {
+		ns, ok := rr.Data.(*NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(rr.Name)
+		if owner == zone || !isSubdomain(owner, zone) || !isSubdomain(name, owner) {
+			continue
+		}
+		if next.zone == "" {
+			next.zone, ttl = owner, rr.TTL
+		} else if owner != next.zone {
+			continue
+		}
+		if rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+		next.servers = append(next.servers, nameserver{host: strings.ToLower(ns.Host)})
+	}
+	if next.zone == "" {
+		return nil
+	}
+
+	for i := range next.servers {
+		ns := &next.servers[i]
+		if !isSubdomain(ns.host, zone) {
+			continue
+		}
+		ns.addrs = glue(resp.Additional, ns.host)
+	}
+
+	lifetime := time.Duration(ttl) * time.Second
+	if lifetime < minDelegationTTL {
+		lifetime = minDelegationTTL
+	} else if lifetime > maxDelegationTTL {
+		lifetime = maxDelegationTTL
+	}
+	next.expires = time.Now().Add(lifetime)
+	return next
+}
+
+// glue collects the addresses of host from rrs, IPv4 first.
+func glue(rrs []RR, host string) []string {
+	var v4, v6 []string
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Name, host) {
+			continue
+		}
+		switch data := rr.Data.(type) {
+		case *A:
+			v4 = append(v4, net.JoinHostPort(data.IP.String(), "53"))
+		case *AAAA:
+			v6 = append(v6, net.JoinHostPort(data.IP.String(), "53"))
+		}
+	}
+	return append(v4, v6...)
+}
+
+// closest returns the deepest unexpired delegation known for name.
+func (it *Iterator) closest(name string) *delegation {
+	now := time.Now()
+
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+
+	for zone := name; zone != "."; zone = parentZone(zone) {
+		if d, ok := it.delegations[zone]; ok && now.Before(d.expires) {
+			return d
+		}
+	}
+	return it.roots
+}
+
+func (it *Iterator) remember(d *delegation) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if len(it.delegations) >= maxDelegations {
+		now := time.Now()
+		for zone, old := range it.delegations {
+			if !now.Before(old.expires) {
+				delete(it.delegations, zone)
+			}
+		}
+		if len(it.delegations) >= maxDelegations {
+			it.delegations = make(map[string]*delegation)
+		}
+	}
+	it.delegations[d.zone] = d
+}
+
+func (t *Trace) lame(zone, server, reason string) {
+	t.Lame = append(t.Lame, Lame{Zone: zone, Server: server, Reason: reason})
+}
+
+// parseRootHints reads a named.root file into the root delegation.
+func parseRootHints(data []byte) *delegation {
+	var hosts []string
+	addrs := make(map[string][]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		owner := strings.ToLower(fields[0])
+		value := fields[len(fields)-1]
+		switch strings.ToUpper(fields[len(fields)-2]) {
+		case "NS":
+			hosts = append(hosts, strings.ToLower(value))
+		case "A", "AAAA":
+			addrs[owner] = append(addrs[owner], net.JoinHostPort(value, "53"))
+		}
+	}
+
+	roots := &delegation{zone: "."}
+	for _, host := range hosts {
+		// Listed A before AAAA, so IPv4 is tried first
+		roots.servers = append(roots.servers, nameserver{host: host, addrs: addrs[host]})
+	}
+	return roots
+}
+
+// dedupeLame returns the distinct lame servers of several lookups, sorted.
+func dedupeLame(traces []*Trace) []string {
+	seen := make(map[string]bool)
+	var lame []string
+	for _, t := range traces {
+		if t == nil {
+			continue
+		}
+		for _, l := range t.Lame {
+			s := l.String()
+			if !seen[s] {
+				seen[s] = true
+				lame = append(lame, s)
+			}
+		}
+	}
+	sort.Strings(lame)
+	return lame
+}
+
+func hasType(rrs []RR, name string, qtype uint16) bool {
+	for _, rr := range rrs {
+		if rr.Type == qtype && strings.EqualFold(rr.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func serverName(host, addr string) string {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+	return fmt.Sprintf("%s (%s)", strings.TrimSuffix(host, "."), ip)
+}
+
+// isSubdomain reports whether name is zone or below it. Both are lower case
+// and fully qualified.
+func isSubdomain(name, zone string) bool {
+	return zone == "." || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+func parentZone(zone string) string {
+	i := strings.IndexByte(zone, '.')
+	if i < 0 || i == len(zone)-1 {
+		return "."
+	}
+	return zone[i+1:]
+}
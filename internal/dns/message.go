@@ -0,0 +1,965 @@
+package dns
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Record types
+const (
+	TypeA      uint16 = 1
+	TypeNS     uint16 = 2
+	TypeCNAME  uint16 = 5
+	TypeSOA    uint16 = 6
+	TypePTR    uint16 = 12
+	TypeMX     uint16 = 15
+	TypeTXT    uint16 = 16
+	TypeAAAA   uint16 = 28
+	TypeSRV    uint16 = 33
+	TypeOPT    uint16 = 41
+	TypeDS     uint16 = 43
+	TypeRRSIG  uint16 = 46
+	TypeNSEC   uint16 = 47
+	TypeDNSKEY uint16 = 48
+	TypeNSEC3  uint16 = 50
+	TypeSVCB   uint16 = 64
+	TypeHTTPS  uint16 = 65
+	TypeIXFR   uint16 = 251
+	TypeAXFR   uint16 = 252
+	TypeCAA    uint16 = 257
+)
+
+const ClassINET uint16 = 1
+
+// Response codes
+const (
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeServFail = 2
+	RcodeNXDomain = 3
+	RcodeNotImp   = 4
+	RcodeRefused  = 5
+)
+
+var typeNames = map[uint16]string{
+	TypeA:      "A",
+	TypeNS:     "NS",
+	TypeCNAME:  "CNAME",
+	TypeSOA:    "SOA",
+	TypePTR:    "PTR",
+	TypeMX:     "MX",
+	TypeTXT:    "TXT",
+	TypeAAAA:   "AAAA",
+	TypeSRV:    "SRV",
+	TypeOPT:    "OPT",
+	TypeDS:     "DS",
+	TypeRRSIG:  "RRSIG",
+	TypeNSEC:   "NSEC",
+	TypeDNSKEY: "DNSKEY",
+	TypeNSEC3:  "NSEC3",
+	TypeSVCB:   "SVCB",
+	TypeHTTPS:  "HTTPS",
+	TypeIXFR:   "IXFR",
+	TypeAXFR:   "AXFR",
+	TypeCAA:    "CAA",
+}
+
+var rcodeNames = map[int]string{
+	RcodeSuccess:  "NOERROR",
+	RcodeFormErr:  "FORMERR",
+	RcodeServFail: "SERVFAIL",
+	RcodeNXDomain: "NXDOMAIN",
+	RcodeNotImp:   "NOTIMP",
+	RcodeRefused:  "REFUSED",
+}
+
+func TypeString(t uint16) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// TypeFromString is the inverse of TypeString.
+func TypeFromString(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	for t, name := range typeNames {
+		if name == s {
+			return t, true
+		}
+	}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(s, "TYPE"), 10, 16); err == nil && strings.HasPrefix(s, "TYPE") {
+		return uint16(n), true
+	}
+	return 0, false
+}
+
+func RcodeString(rcode int) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(rcode)
+}
+
+var (
+	errShortMessage = errors.New("dns: message too short")
+	errPointerLoop  = errors.New("dns: too many compression pointers")
+	errLabelLength  = errors.New("dns: label longer than 63 bytes")
+)
+
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             int
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticatedData  bool
+	CheckingDisabled   bool
+	Rcode              int // Includes the EDNS extended bits once unpacked
+}
+
+type Question struct {
+	Name  string // Fully qualified, with the trailing dot
+	Type  uint16
+	Class uint16
+}
+
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  RData
+}
+
+func (rr RR) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s", rr.Name, rr.TTL, TypeString(rr.Type), rr.Data)
+}
+
+// EDNS is the OPT pseudo-record of RFC 6891.
+type EDNS struct {
+	UDPSize uint16
+	Version uint8
+	DNSSEC  bool // DO bit: ask for RRSIGs
+}
+
+type Msg struct {
+	Header
+	Question   []Question
+	Answer     []RR
+	Authority  []RR
+	Additional []RR // Without the OPT record, which is in EDNS
+	EDNS       *EDNS
+}
+
+// NewQuery builds a recursive query for one name and type.
+func NewQuery(name string, qtype uint16) *Msg {
+	return &Msg{
+		Header:   Header{RecursionDesired: true},
+		Question: []Question{{Name: Fqdn(name), Type: qtype, Class: ClassINET}},
+	}
+}
+
+// Fqdn adds the trailing dot if name lacks it.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// RData is the type-specific part of a resource record.
+type RData interface {
+	// pack appends the uncompressed wire form
+	pack(b []byte) ([]byte, error)
+	String() string
+}
+
+type A struct{ IP net.IP }
+type AAAA struct{ IP net.IP }
+type NS struct{ Host string }
+type CNAME struct{ Target string }
+type PTR struct{ Host string }
+
+type MX struct {
+	Preference uint16
+	Host       string
+}
+
+type TXT struct{ Strings []string }
+
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+type CAA struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+type RRSIG struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  uint32 // Seconds since the epoch, modulo 2^32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+type NSEC struct {
+	NextDomain string
+	Types      []uint16
+}
+
+type NSEC3 struct {
+	Hash       uint8
+	Flags      uint8 // Bit 0 is opt-out
+	Iterations uint16
+	Salt       []byte
+	NextHashed []byte
+	Types      []uint16
+}
+
+// SVCB is the rdata of both SVCB and HTTPS records (RFC 9460).
+type SVCB struct {
+	Priority uint16
+	Target   string
+	Params   []SVCParam
+}
+
+type SVCParam struct {
+	Key   uint16
+	Value []byte
+}
+
+// SvcParamKey values
+const (
+	SVCKeyMandatory     uint16 = 0
+	SVCKeyALPN          uint16 = 1
+	SVCKeyNoDefaultALPN uint16 = 2
+	SVCKeyPort          uint16 = 3
+	SVCKeyIPv4Hint      uint16 = 4
+	SVCKeyECH           uint16 = 5
+	SVCKeyIPv6Hint      uint16 = 6
+)
+
+// ALPN returns the protocol IDs advertised in the alpn parameter.
+func (r *SVCB) ALPN() []string {
+	for _, p := range r.Params {
+		if p.Key != SVCKeyALPN {
+			continue
+		}
+		var ids []string
+		for i := 0; i < len(p.Value); {
+			n := int(p.Value[i])
+			if i+1+n > len(p.Value) {
+				break
+			}
+			ids = append(ids, string(p.Value[i+1:i+1+n]))
+			i += 1 + n
+		}
+		return ids
+	}
+	return nil
+}
+
+// Unknown holds rdata of types this package does not parse.
+type Unknown struct{ Data []byte }
+
+func (r *A) pack(b []byte) ([]byte, error)    { return append(b, r.IP.To4()...), nil }
+func (r *AAAA) pack(b []byte) ([]byte, error) { return append(b, r.IP.To16()...), nil }
+func (r *NS) pack(b []byte) ([]byte, error)   { return packName(b, r.Host) }
+func (r *CNAME) pack(b []byte) ([]byte, error) {
+	return packName(b, r.Target)
+}
+func (r *PTR) pack(b []byte) ([]byte, error) { return packName(b, r.Host) }
+func (r *MX) pack(b []byte) ([]byte, error) {
+	return packName(binary.BigEndian.AppendUint16(b, r.Preference), r.Host)
+}
+func (r *TXT) pack(b []byte) ([]byte, error) {
+	for _, s := range r.Strings {
+		if len(s) > 255 {
+			return nil, errors.New("dns: TXT string longer than 255 bytes")
+		}
+		b = append(append(b, byte(len(s))), s...)
+	}
+	return b, nil
+}
+func (r *SOA) pack(b []byte) ([]byte, error) {
+	b, err := packName(b, r.MName)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = packName(b, r.RName); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint32{r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum} {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b, nil
+}
+func (r *SRV) pack(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, r.Priority)
+	b = binary.BigEndian.AppendUint16(b, r.Weight)
+	b = binary.BigEndian.AppendUint16(b, r.Port)
+	return packName(b, r.Target)
+}
+func (r *CAA) pack(b []byte) ([]byte, error) {
+	b = append(b, r.Flag, byte(len(r.Tag)))
+	return append(append(b, r.Tag...), r.Value...), nil
+}
+func (r *DS) pack(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, r.KeyTag)
+	return append(append(b, r.Algorithm, r.DigestType), r.Digest...), nil
+}
+func (r *DNSKEY) pack(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, r.Flags)
+	return append(append(b, r.Protocol, r.Algorithm), r.PublicKey...), nil
+}
+func (r *RRSIG) pack(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, r.TypeCovered)
+	b = append(b, r.Algorithm, r.Labels)
+	b = binary.BigEndian.AppendUint32(b, r.OrigTTL)
+	b = binary.BigEndian.AppendUint32(b, r.Expiration)
+	b = binary.BigEndian.AppendUint32(b, r.Inception)
+	b = binary.BigEndian.AppendUint16(b, r.KeyTag)
+	b, err := packName(b, r.SignerName)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, r.Signature...), nil
+}
+func (r *NSEC) pack(b []byte) ([]byte, error) {
+	b, err := packName(b, r.NextDomain)
+	if err != nil {
+		return nil, err
+	}
+	return packTypeBitmap(b, r.Types), nil
+}
+func (r *NSEC3) pack(b []byte) ([]byte, error) {
+	b = append(b, r.Hash, r.Flags)
+	b = binary.BigEndian.AppendUint16(b, r.Iterations)
+	b = append(append(b, byte(len(r.Salt))), r.Salt...)
+	b = append(append(b, byte(len(r.NextHashed))), r.NextHashed...)
+	return packTypeBitmap(b, r.Types), nil
+}
+func (r *SVCB) pack(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, r.Priority)
+	b, err := packName(b, r.Target)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range r.Params {
+		b = binary.BigEndian.AppendUint16(b, p.Key)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(p.Value)))
+		b = append(b, p.Value...)
+	}
+	return b, nil
+}
+func (r *Unknown) pack(b []byte) ([]byte, error) { return append(b, r.Data...), nil }
+
+func (r *A) String() string     { return r.IP.String() }
+func (r *AAAA) String() string  { return r.IP.String() }
+func (r *NS) String() string    { return r.Host }
+func (r *CNAME) String() string { return r.Target }
+func (r *PTR) String() string   { return r.Host }
+func (r *MX) String() string    { return fmt.Sprintf("%d %s", r.Preference, r.Host) }
+func (r *TXT) String() string   { return strings.Join(r.Strings, "") }
+func (r *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", r.MName, r.RName, r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum)
+}
+func (r *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target)
+}
+func (r *CAA) String() string { return fmt.Sprintf("%d %s %q", r.Flag, r.Tag, r.Value) }
+func (r *DS) String() string {
+	return fmt.Sprintf("%d %d %d %X", r.KeyTag, r.Algorithm, r.DigestType, r.Digest)
+}
+func (r *DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Flags, r.Protocol, r.Algorithm, base64.StdEncoding.EncodeToString(r.PublicKey))
+}
+func (r *RRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %d %d %d %s %s", TypeString(r.TypeCovered), r.Algorithm, r.Labels, r.OrigTTL,
+		r.Expiration, r.Inception, r.KeyTag, r.SignerName, base64.StdEncoding.EncodeToString(r.Signature))
+}
+func (r *NSEC) String() string { return r.NextDomain + " " + typeList(r.Types) }
+func (r *NSEC3) String() string {
+	salt := "-"
+	if len(r.Salt) > 0 {
+		salt = fmt.Sprintf("%X", r.Salt)
+	}
+	return fmt.Sprintf("%d %d %d %s %s %s", r.Hash, r.Flags, r.Iterations, salt,
+		base32Hex.EncodeToString(r.NextHashed), typeList(r.Types))
+}
+func (r *SVCB) String() string {
+	parts := []string{strconv.Itoa(int(r.Priority)), r.Target}
+	for _, p := range r.Params {
+		switch p.Key {
+		case SVCKeyALPN:
+			parts = append(parts, "alpn="+strings.Join(r.ALPN(), ","))
+		case SVCKeyNoDefaultALPN:
+			parts = append(parts, "no-default-alpn")
+		case SVCKeyPort:
+			if len(p.Value) == 2 {
+				parts = append(parts, "port="+strconv.Itoa(int(binary.BigEndian.Uint16(p.Value))))
+			}
+		case SVCKeyIPv4Hint, SVCKeyIPv6Hint:
+			size, name := net.IPv4len, "ipv4hint="
+			if p.Key == SVCKeyIPv6Hint {
+				size, name = net.IPv6len, "ipv6hint="
+			}
+			var ips []string
+			for i := 0; i+size <= len(p.Value); i += size {
+				ips = append(ips, net.IP(p.Value[i:i+size]).String())
+			}
+			parts = append(parts, name+strings.Join(ips, ","))
+		case SVCKeyECH:
+			parts = append(parts, "ech="+base64.StdEncoding.EncodeToString(p.Value))
+		default:
+			parts = append(parts, fmt.Sprintf("key%d=%x", p.Key, p.Value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+func (r *Unknown) String() string { return fmt.Sprintf("\\# %d %x", len(r.Data), r.Data) }
+
+// Pack encodes the message without name compression.
+func (m *Msg) Pack() ([]byte, error) {
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	if m.AuthenticatedData {
+		flags |= 1 << 5
+	}
+	if m.CheckingDisabled {
+		flags |= 1 << 4
+	}
+	flags |= uint16(m.Rcode & 0xf)
+
+	additional := len(m.Additional)
+	if m.EDNS != nil {
+		additional++
+	}
+
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Question)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answer)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(additional))
+
+	var err error
+	for _, q := range m.Question {
+		if b, err = packName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+
+	for _, section := range [][]RR{m.Answer, m.Authority, m.Additional} {
+		for _, rr := range section {
+			if b, err = packRR(b, rr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if m.EDNS != nil {
+		// OPT: root owner, class = UDP size, TTL = extended rcode, version, flags
+		b = append(b, 0)
+		b = binary.BigEndian.AppendUint16(b, TypeOPT)
+		b = binary.BigEndian.AppendUint16(b, m.EDNS.UDPSize)
+		ttl := uint32(m.Rcode>>4)<<24 | uint32(m.EDNS.Version)<<16
+		if m.EDNS.DNSSEC {
+			ttl |= 1 << 15
+		}
+		b = binary.BigEndian.AppendUint32(b, ttl)
+		b = binary.BigEndian.AppendUint16(b, 0)
+	}
+
+	return b, nil
+}
+
+func packRR(b []byte, rr RR) ([]byte, error) {
+	b, err := packName(b, rr.Name)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, rr.Type)
+	b = binary.BigEndian.AppendUint16(b, rr.Class)
+	b = binary.BigEndian.AppendUint32(b, rr.TTL)
+
+	lengthAt := len(b)
+	b = append(b, 0, 0)
+	if b, err = rr.Data.pack(b); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[lengthAt:], uint16(len(b)-lengthAt-2))
+	return b, nil
+}
+
+func packName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 {
+				return nil, fmt.Errorf("dns: empty label in %q", name)
+			}
+			if len(label) > 63 {
+				return nil, errLabelLength
+			}
+			b = append(append(b, byte(len(label))), label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// Unpack decodes a message received from the network.
+func (m *Msg) Unpack(msg []byte) error {
+	if len(msg) < 12 {
+		return errShortMessage
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	m.Header = Header{
+		ID:                 binary.BigEndian.Uint16(msg[0:]),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             int(flags>>11) & 0xf,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		AuthenticatedData:  flags&(1<<5) != 0,
+		CheckingDisabled:   flags&(1<<4) != 0,
+		Rcode:              int(flags & 0xf),
+	}
+
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+
+	off := 12
+	m.Question = nil
+	for i := 0; i < counts[0]; i++ {
+		name, next, err := unpackName(msg, off)
+		if err != nil {
+			return err
+		}
+		if next+4 > len(msg) {
+			return errShortMessage
+		}
+		m.Question = append(m.Question, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+
+	m.Answer, m.Authority, m.Additional, m.EDNS = nil, nil, nil, nil
+	sections := []*[]RR{&m.Answer, &m.Authority, &m.Additional}
+	for s, section := range sections {
+		for i := 0; i < counts[s+1]; i++ {
+			rr, next, err := unpackRR(msg, off)
+			if err != nil {
+				// Keep what was parsed; a truncated reply is often cut mid-record
+				if m.Truncated {
+					return nil
+				}
+				return err
+			}
+			off = next
+
+			if rr.Type == TypeOPT {
+				m.EDNS = &EDNS{
+					UDPSize: rr.Class,
+					Version: uint8(rr.TTL >> 16),
+					DNSSEC:  rr.TTL&(1<<15) != 0,
+				}
+				m.Rcode |= int(rr.TTL>>24) << 4
+				continue
+			}
+			*section = append(*section, rr)
+		}
+	}
+
+	return nil
+}
+
+func unpackRR(msg []byte, off int) (RR, int, error) {
+	name, off, err := unpackName(msg, off)
+	if err != nil {
+		return RR{}, 0, err
+	}
+	if off+10 > len(msg) {
+		return RR{}, 0, errShortMessage
+	}
+
+	rr := RR{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(msg[off:]),
+		Class: binary.BigEndian.Uint16(msg[off+2:]),
+		TTL:   binary.BigEndian.Uint32(msg[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	end := off + length
+	if end > len(msg) {
+		return RR{}, 0, errShortMessage
+	}
+
+	rr.Data, err = unpackRData(msg, off, end, rr.Type)
+	if err != nil {
+		return RR{}, 0, fmt.Errorf("dns: bad %s record for %s: %w", TypeString(rr.Type), name, err)
+	}
+	return rr, end, nil
+}
+
+func unpackRData(msg []byte, off, end int, rrtype uint16) (RData, error) {
+	rdata := msg[off:end]
+
+	switch rrtype {
+	case TypeA:
+		if len(rdata) != net.IPv4len {
+			return nil, errShortMessage
+		}
+		return &A{IP: net.IP(append([]byte(nil), rdata...))}, nil
+	case TypeAAAA:
+		if len(rdata) != net.IPv6len {
+			return nil, errShortMessage
+		}
+		return &AAAA{IP: net.IP(append([]byte(nil), rdata...))}, nil
+	case TypeNS, TypeCNAME, TypePTR:
+		name, _, err := unpackName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		switch rrtype {
+		case TypeNS:
+			return &NS{Host: name}, nil
+		case TypeCNAME:
+			return &CNAME{Target: name}, nil
+		}
+		return &PTR{Host: name}, nil
+	case TypeMX:
+		if len(rdata) < 3 {
+			return nil, errShortMessage
+		}
+		name, _, err := unpackName(msg, off+2)
+		if err != nil {
+			return nil, err
+		}
+		return &MX{Preference: binary.BigEndian.Uint16(rdata), Host: name}, nil
+	case TypeTXT:
+		txt := &TXT{}
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				return nil, errShortMessage
+			}
+			txt.Strings = append(txt.Strings, string(rdata[i+1:i+1+n]))
+			i += 1 + n
+		}
+		return txt, nil
+	case TypeSOA:
+		mname, next, err := unpackName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		rname, next, err := unpackName(msg, next)
+		if err != nil {
+			return nil, err
+		}
+		if next+20 > end {
+			return nil, errShortMessage
+		}
+		return &SOA{
+			MName:   mname,
+			RName:   rname,
+			Serial:  binary.BigEndian.Uint32(msg[next:]),
+			Refresh: binary.BigEndian.Uint32(msg[next+4:]),
+			Retry:   binary.BigEndian.Uint32(msg[next+8:]),
+			Expire:  binary.BigEndian.Uint32(msg[next+12:]),
+			Minimum: binary.BigEndian.Uint32(msg[next+16:]),
+		}, nil
+	case TypeSRV:
+		if len(rdata) < 7 {
+			return nil, errShortMessage
+		}
+		target, _, err := unpackName(msg, off+6)
+		if err != nil {
+			return nil, err
+		}
+		return &SRV{
+			Priority: binary.BigEndian.Uint16(rdata),
+			Weight:   binary.BigEndian.Uint16(rdata[2:]),
+			Port:     binary.BigEndian.Uint16(rdata[4:]),
+			Target:   target,
+		}, nil
+	case TypeCAA:
+		if len(rdata) < 2 || 2+int(rdata[1]) > len(rdata) {
+			return nil, errShortMessage
+		}
+		tagEnd := 2 + int(rdata[1])
+		return &CAA{Flag: rdata[0], Tag: string(rdata[2:tagEnd]), Value: string(rdata[tagEnd:])}, nil
+	case TypeDS:
+		if len(rdata) < 4 {
+			return nil, errShortMessage
+		}
+		return &DS{
+			KeyTag:     binary.BigEndian.Uint16(rdata),
+			Algorithm:  rdata[2],
+			DigestType: rdata[3],
+			Digest:     append([]byte(nil), rdata[4:]...),
+		}, nil
+	case TypeDNSKEY:
+		if len(rdata) < 4 {
+			return nil, errShortMessage
+		}
+		return &DNSKEY{
+			Flags:     binary.BigEndian.Uint16(rdata),
+			Protocol:  rdata[2],
+			Algorithm: rdata[3],
+			PublicKey: append([]byte(nil), rdata[4:]...),
+		}, nil
+	case TypeRRSIG:
+		if len(rdata) < 19 {
+			return nil, errShortMessage
+		}
+		signer, next, err := unpackName(msg, off+18)
+		if err != nil {
+			return nil, err
+		}
+		if next > end {
+			return nil, errShortMessage
+		}
+		return &RRSIG{
+			TypeCovered: binary.BigEndian.Uint16(rdata),
+			Algorithm:   rdata[2],
+			Labels:      rdata[3],
+			OrigTTL:     binary.BigEndian.Uint32(rdata[4:]),
+			Expiration:  binary.BigEndian.Uint32(rdata[8:]),
+			Inception:   binary.BigEndian.Uint32(rdata[12:]),
+			KeyTag:      binary.BigEndian.Uint16(rdata[16:]),
+			SignerName:  signer,
+			Signature:   append([]byte(nil), msg[next:end]...),
+		}, nil
+	case TypeNSEC:
+		next, after, err := unpackName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if after > end {
+			return nil, errShortMessage
+		}
+		types, err := unpackTypeBitmap(msg[after:end])
+		if err != nil {
+			return nil, err
+		}
+		return &NSEC{NextDomain: next, Types: types}, nil
+	case TypeNSEC3:
+		if len(rdata) < 5 {
+			return nil, errShortMessage
+		}
+		saltEnd := 5 + int(rdata[4])
+		if saltEnd >= len(rdata) {
+			return nil, errShortMessage
+		}
+		hashEnd := saltEnd + 1 + int(rdata[saltEnd])
+		if hashEnd > len(rdata) {
+			return nil, errShortMessage
+		}
+		types, err := unpackTypeBitmap(rdata[hashEnd:])
+		if err != nil {
+			return nil, err
+		}
+		return &NSEC3{
+			Hash:       rdata[0],
+			Flags:      rdata[1],
+			Iterations: binary.BigEndian.Uint16(rdata[2:]),
+			Salt:       append([]byte(nil), rdata[5:saltEnd]...),
+			NextHashed: append([]byte(nil), rdata[saltEnd+1:hashEnd]...),
+			Types:      types,
+		}, nil
+	case TypeSVCB, TypeHTTPS:
+		if len(rdata) < 3 {
+			return nil, errShortMessage
+		}
+		// The target name is never compressed (RFC 9460 section 2.2)
+		target, next, err := unpackName(msg, off+2)
+		if err != nil {
+			return nil, err
+		}
+		svcb := &SVCB{Priority: binary.BigEndian.Uint16(rdata), Target: target}
+		for next < end {
+			if next+4 > end {
+				return nil, errShortMessage
+			}
+			key := binary.BigEndian.Uint16(msg[next:])
+			length := int(binary.BigEndian.Uint16(msg[next+2:]))
+			if next+4+length > end {
+				return nil, errShortMessage
+			}
+			svcb.Params = append(svcb.Params, SVCParam{Key: key, Value: append([]byte(nil), msg[next+4:next+4+length]...)})
+			next += 4 + length
+		}
+		return svcb, nil
+	}
+
+	return &Unknown{Data: append([]byte(nil), rdata...)}, nil
+}
+
+// Base32 with the extended hex alphabet, as used in NSEC3 owner names
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// packTypeBitmap encodes types in the window blocks of RFC 4034 section 4.1.2.
+func packTypeBitmap(b []byte, types []uint16) []byte {
+	sorted := append([]uint16(nil), types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for i := 0; i < len(sorted); {
+		window := sorted[i] >> 8
+		var bitmap [32]byte
+		length := 0
+		for ; i < len(sorted) && sorted[i]>>8 == window; i++ {
+			low := sorted[i] & 0xff
+			bitmap[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+		b = append(append(b, byte(window), byte(length)), bitmap[:length]...)
+	}
+	return b
+}
+
+func unpackTypeBitmap(data []byte) ([]uint16, error) {
+	var types []uint16
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return nil, errShortMessage
+		}
+		window, length := uint16(data[0]), int(data[1])
+		for i, octet := range data[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if octet&(0x80>>bit) != 0 {
+					types = append(types, window<<8|uint16(i*8+bit))
+				}
+			}
+		}
+		data = data[2+length:]
+	}
+	return types, nil
+}
+
+func typeList(types []uint16) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = TypeString(t)
+	}
+	return strings.Join(names, " ")
+}
+
+// unpackName reads a possibly compressed name and returns it fully
+// qualified together with the offset just past it in the original position.
+func unpackName(msg []byte, off int) (string, int, error) {
+	var (
+		name     strings.Builder
+		next     = -1
+		pointers = 0
+	)
+
+	for {
+		if off >= len(msg) {
+			return "", 0, errShortMessage
+		}
+		c := int(msg[off])
+
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				if name.Len() == 0 {
+					return ".", next, nil
+				}
+				return name.String(), next, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errShortMessage
+			}
+			name.Write(msg[off+1 : off+1+c])
+			name.WriteByte('.')
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errShortMessage
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			if pointers++; pointers > 32 {
+				return "", 0, errPointerLoop
+			}
+			off = (c&0x3f)<<8 | int(msg[off+1])
+		default:
+			return "", 0, fmt.Errorf("dns: unsupported label type %#x", c)
+		}
+	}
+}
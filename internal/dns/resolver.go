@@ -2,20 +2,143 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
 	"net"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/recon-scanner/internal/config"
 	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/mailsec"
+	"github.com/recon-scanner/internal/normalize"
 )
 
 type Resolver struct {
-	config *config.HighPerformanceConfig
+	config    *config.HighPerformanceConfig
+	client    *Client
+	iterator  *Iterator // Set in iterative mode, which bypasses the upstreams
+	validator *Validator
+	wildcard  *WildcardDetector
+	mail      *mailsec.Checker
+	types     []uint16 // Record types queried for every domain
+	srvNames  []string
+	dangling  *DanglingDetector
 }
 
 func NewHighPerformance(cfg *config.HighPerformanceConfig) *Resolver {
-	return &Resolver{config: cfg}
+	servers := cfg.Upstreams
+	if len(servers) == 0 {
+		servers = SystemServers()
+	}
+
+	tlsConfig, err := upstreamTLSConfig(cfg.UpstreamCAFile)
+	if err != nil {
+		log.Printf("Failed to load upstream CA file, using the system roots: %v", err)
+	}
+
+	upstreams := NewUpstreamPool(servers, PoolOptions{
+		QPS:           cfg.UpstreamQPS,
+		CheckInterval: cfg.UpstreamCheckInterval,
+		EjectFor:      cfg.UpstreamEjectTime,
+		MaxErrorRate:  cfg.UpstreamMaxErrorRate,
+		DoHMethod:     cfg.DoHMethod,
+		TLSConfig:     tlsConfig,
+	})
+
+	fingerprints, err := LoadFingerprints(cfg.CNAMEFingerprintFile)
+	if err != nil {
+		log.Printf("Failed to load CNAME fingerprints, using the built-in set: %v", err)
+		fingerprints, _ = LoadFingerprints("")
+	}
+
+	client := NewClient(upstreams, cfg.ReadTimeout, cfg.RetryAttempts)
+	client.DNSSEC = cfg.DNSSEC
+	if size := cacheBudget(cfg); size > 0 {
+		client.Cache = NewCache(CacheOptions{
+			MaxBytes:       size,
+			MaxTTL:         cfg.DNSCacheMaxTTL,
+			MaxNegativeTTL: cfg.DNSCacheMaxNegativeTTL,
+		})
+	}
+
+	r := &Resolver{
+		config:   cfg,
+		client:   client,
+		types:    parseRecordTypes(cfg.RecordTypes),
+		srvNames: cfg.SRVNames,
+		dangling: NewDanglingDetector(fingerprints, cfg.DanglingHTTPTimeout),
+	}
+	if cfg.Iterative {
+		r.iterator = NewIterator(client)
+	}
+	if cfg.WildcardProbes > 0 {
+		r.wildcard = NewWildcardDetector(cfg.WildcardProbes, func(ctx context.Context, name string, qtype uint16) (*Msg, error) {
+			resp, _, err := r.lookup(ctx, name, qtype)
+			return resp, err
+		})
+	}
+	if cfg.MailSecurity {
+		r.mail = mailsec.NewChecker(cfg.DKIMSelectors, cfg.MTASTSPolicyTimeout, r.lookupTXT)
+	}
+	if cfg.DNSSEC {
+		r.validator = NewValidator(func(ctx context.Context, name string, qtype uint16) (*Msg, error) {
+			resp, _, err := r.lookup(ctx, name, qtype)
+			return resp, err
+		})
+	}
+	return r
+}
+
+// upstreamTLSConfig trusts the certificates in caFile on top of the system
+// roots, so DoT and DoH upstreams with a private CA can be used.
+func upstreamTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}, nil
+}
+
+// cacheBudget keeps the answer cache to an eighth of the memory ceiling.
+func cacheBudget(cfg *config.HighPerformanceConfig) int64 {
+	size := cfg.DNSCacheSize
+	if cfg.MaxMemoryUsage > 0 && size > cfg.MaxMemoryUsage/8 {
+		size = cfg.MaxMemoryUsage / 8
+	}
+	return size
+}
+
+func parseRecordTypes(names []string) []uint16 {
+	if len(names) == 0 {
+		names = config.DefaultRecordTypes()
+	}
+
+	var types []uint16
+	for _, name := range names {
+		qtype, ok := TypeFromString(name)
+		if !ok || qtype == TypeOPT || qtype == TypeAXFR || qtype == TypeIXFR {
+			log.Printf("Ignoring unknown record type %q", name)
+			continue
+		}
+		types = append(types, qtype)
+	}
+	return types
 }
 
 func New(cfg *config.Config) *Resolver {
@@ -25,14 +148,110 @@ func New(cfg *config.Config) *Resolver {
 		ReadTimeout:       5 * time.Second,
 		WriteTimeout:      5 * time.Second,
 		RetryAttempts:     3,
+		RecordTypes:       cfg.RecordTypes,
+		SRVNames:          cfg.SRVNames,
+
+		MaxMemoryUsage:         cfg.MaxMemoryUsage,
+		WildcardProbes:         2,
+		ZoneTransfers:          cfg.ZoneTransfers,
+		ZoneTransferPort:       53,
+		ZoneTransferTimeout:    30 * time.Second,
+		MailSecurity:           cfg.MailSecurity,
+		DKIMSelectors:          config.DefaultDKIMSelectors(),
+		MTASTSPolicyTimeout:    5 * time.Second,
+		DNSCacheSize:           128 * 1024 * 1024,
+		DNSCacheMaxTTL:         24 * time.Hour,
+		DNSCacheMaxNegativeTTL: 3 * time.Hour,
+	}
+	return NewHighPerformance(hpConfig)
+}
+
+// UpstreamStats reports the health of each upstream resolver, none in
+// iterative mode.
+func (r *Resolver) UpstreamStats() []UpstreamStats {
+	if r.iterator != nil {
+		return nil
 	}
-	return &Resolver{config: hpConfig}
+	return r.client.Upstreams.Stats()
 }
 
+// lookup asks the upstreams, or the authoritative servers in iterative mode.
+// The trace is nil for upstream lookups.
+func (r *Resolver) lookup(ctx context.Context, name string, qtype uint16) (*Msg, *Trace, error) {
+	if r.iterator != nil {
+		return r.iterator.Query(ctx, name, qtype)
+	}
+	resp, err := r.client.Query(ctx, name, qtype)
+	return resp, nil, err
+}
+
+// lookupTXT returns the TXT records at name, each as one string. A name
+// that does not exist has none; only failed lookups are errors.
+func (r *Resolver) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	resp, _, err := r.lookup(ctx, name, TypeTXT)
+	if resp == nil || (resp.Rcode != RcodeSuccess && resp.Rcode != RcodeNXDomain) {
+		return nil, err
+	}
+
+	var texts []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.Data.(*TXT); ok {
+			texts = append(texts, txt.String())
+		}
+	}
+	return texts, nil
+}
+
+// CacheStats reports answer cache use; all zero when caching is off.
+func (r *Resolver) CacheStats() CacheStats {
+	if r.client.Cache == nil {
+		return CacheStats{}
+	}
+	return r.client.Cache.Stats()
+}
+
+// ShrinkCache evicts cached answers down to fraction of the cache budget.
+func (r *Resolver) ShrinkCache(fraction float64) {
+	if r.client.Cache != nil {
+		r.client.Cache.Shrink(fraction)
+	}
+}
+
+// query is one lookup made for a domain. SRV lookups go to service names
+// below the domain, so their NXDOMAIN says nothing about the domain itself.
+type query struct {
+	name    string
+	qtype   uint16
+	service string // SRV label, e.g. _sip._tcp
+}
+
+func (r *Resolver) queries(domain string) []query {
+	var queries []query
+	for _, qtype := range r.types {
+		if qtype != TypeSRV {
+			queries = append(queries, query{name: domain, qtype: qtype})
+			continue
+		}
+		for _, service := range r.srvNames {
+			queries = append(queries, query{name: service + "." + domain, qtype: TypeSRV, service: service})
+		}
+	}
+	return queries
+}
+
+// ResolveDomain queries every record type in parallel, each with its own
+// deadline, so one slow type cannot starve the others. The result holds
+// whatever was answered and a status per type. When any type failed, a
+// *LookupError is returned along with the result; it is retryable only if
+// the address lookup failed transiently.
 func (r *Resolver) ResolveDomain(domain string) (*database.DomainResult, error) {
 	result := &database.DomainResult{
 		Domain:      domain,
+		Apex:        normalize.Apex(domain),
 		ProcessedAt: time.Now(),
+		TTLs:        make(map[string]uint32),
+		Rcodes:      make(map[string]string),
+		Statuses:    make(map[string]string),
 	}
 
 	// Set timeouts based on configuration
@@ -41,87 +260,409 @@ func (r *Resolver) ResolveDomain(domain string) (*database.DomainResult, error)
 		timeout = 10 * time.Second
 	}
 
-	// Create a context with timeout for all DNS operations
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: timeout,
-			}
-			return d.DialContext(ctx, network, address)
-		},
+	// Cancelled early once any type proves the name does not exist
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type answer struct {
+		resp  *Msg
+		trace *Trace
+		err   error
 	}
+	queries := r.queries(domain)
+	answers := make([]answer, len(queries))
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q query) {
+			defer wg.Done()
 
-	// A and AAAA records
-	if ips, err := resolver.LookupIPAddr(ctx, domain); err == nil {
-		for _, ip := range ips {
-			if ip.IP.To4() != nil {
-				result.ARecords = append(result.ARecords, ip.IP.String())
-			} else {
-				result.AAAARecords = append(result.AAAARecords, ip.IP.String())
+			ctx, cancelQuery := context.WithTimeout(parent, timeout)
+			defer cancelQuery()
+
+			resp, trace, err := r.lookup(ctx, q.name, q.qtype)
+			if q.service == "" && provesNXDomain(resp, q.name) {
+				cancel()
 			}
-		}
+			answers[i] = answer{resp: resp, trace: trace, err: err}
+		}(i, q)
 	}
+	wg.Wait()
 
-	// MX records
-	if mxRecords, err := resolver.LookupMX(ctx, domain); err == nil {
-		for _, mx := range mxRecords {
-			result.MXRecords = append(result.MXRecords, mx.Host)
+	nxdomain := false
+	for i, a := range answers {
+		if queries[i].service == "" && provesNXDomain(a.resp, queries[i].name) {
+			nxdomain = true
 		}
 	}
 
-	// CNAME record
-	if cname, err := resolver.LookupCNAME(ctx, domain); err == nil {
-		if cname != domain+"." { // Only add if it is actually a CNAME
-			result.CNAMERecords = append(result.CNAMERecords, strings.TrimSuffix(cname, "."))
+	lookupErr := &LookupError{Domain: domain, Statuses: make(map[string]string)}
+	srvStatus := ""
+	for i, q := range queries {
+		name := TypeString(q.qtype)
+		a := answers[i]
+
+		var status string
+		switch {
+		case a.resp != nil:
+			found := a.err == nil && addAnswer(result, q, a.resp)
+			status = lookupStatus(a.resp, a.err, found)
+			if q.service == "" {
+				result.Rcodes[name] = RcodeString(a.resp.Rcode)
+			}
+		case nxdomain:
+			// Abandoned because another type came back NXDOMAIN
+			status = StatusNXDomain
+		default:
+			status = lookupStatus(nil, a.err, false)
+		}
+
+		if q.service != "" {
+			srvStatus = mergeSRVStatus(srvStatus, status)
+			continue
+		}
+
+		result.Statuses[name] = status
+		if IsFailure(status) {
+			lookupErr.Statuses[name] = status
+			if q.qtype == TypeA {
+				lookupErr.Err = a.err
+			}
 		}
 	}
 
-	// NS records
-	if nsRecords, err := resolver.LookupNS(ctx, domain); err == nil {
-		for _, ns := range nsRecords {
-			result.NSRecords = append(result.NSRecords, strings.TrimSuffix(ns.Host, "."))
+	var addrResp *Msg
+	if i := addressQuery(queries, func(i int) bool { return answers[i].resp != nil }); i >= 0 {
+		addrResp = answers[i].resp
+		r.checkChain(result, addrResp)
+		if answers[i].trace != nil {
+			result.AuthServer = answers[i].trace.Server
+		}
+	}
+	if r.wildcard != nil && result.Apex != "" {
+		ctx, cancelProbe := context.WithTimeout(context.Background(), timeout)
+		wz, fresh := r.wildcard.Check(ctx, result.Apex)
+		cancelProbe()
+		if fresh {
+			result.Wildcard = wz
 		}
+		result.WildcardMatch = MatchesWildcard(result, wz)
+	}
+	if r.mail != nil && !nxdomain {
+		ctx, cancelMail := context.WithTimeout(context.Background(), timeout+r.config.MTASTSPolicyTimeout)
+		result.MailSecurity = r.mail.Check(ctx, domain)
+		cancelMail()
+	}
+	if r.config.ZoneTransfers && len(result.NSRecords) > 0 {
+		result.ZoneTransfers, result.TransferRecords = r.transferZone(domain, result.NSRecords)
+	}
+	if r.validator != nil {
+		ctx, cancelValidation := context.WithTimeout(context.Background(), timeout)
+		result.DNSSECStatus, result.DNSSECReason = r.validator.Validate(ctx, domain, addrResp)
+		cancelValidation()
+	}
+	if r.iterator != nil {
+		traces := make([]*Trace, len(answers))
+		for i, a := range answers {
+			traces[i] = a.trace
+		}
+		result.LameDelegations = dedupeLame(traces)
 	}
 
-	// TXT records
-	if txtRecords, err := resolver.LookupTXT(ctx, domain); err == nil {
-		result.TXTRecords = txtRecords
+	if srvStatus != "" {
+		result.Statuses[TypeString(TypeSRV)] = srvStatus
+		if IsFailure(srvStatus) {
+			lookupErr.Statuses[TypeString(TypeSRV)] = srvStatus
+		}
 	}
 
+	if len(lookupErr.Statuses) > 0 {
+		return result, lookupErr
+	}
 	return result, nil
 }
 
-func (r *Resolver) ReverseLookup(ip string) (string, error) {
+// Probe looks up only the addresses of name, a cheap test of whether a
+// guessed name exists before resolving it in full. The result holds the
+// addresses and CNAME chain; it is nil when name has neither.
+func (r *Resolver) Probe(name string) (*database.DomainResult, error) {
 	timeout := r.config.ConnectionTimeout
 	if timeout == 0 {
 		timeout = 10 * time.Second
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	queries := []query{{name: name, qtype: TypeA}, {name: name, qtype: TypeAAAA}}
+	resps := make([]*Msg, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q query) {
+			defer wg.Done()
+			resps[i], _, errs[i] = r.lookup(ctx, q.name, q.qtype)
+		}(i, q)
+	}
+	wg.Wait()
+
+	result := &database.DomainResult{
+		Domain:      name,
+		Apex:        normalize.Apex(name),
+		ProcessedAt: time.Now(),
+		TTLs:        make(map[string]uint32),
+	}
+	var err error
+	for i, q := range queries {
+		if resps[i] == nil || errs[i] != nil {
+			if err == nil {
+				err = errs[i]
+			}
+			continue
+		}
+		addAnswer(result, q, resps[i])
+		if result.CNAMEChain == nil {
+			result.CNAMEChain = followCNAMEs(name, resps[i].Answer)
+		}
+	}
 
+	if len(result.ARecords)+len(result.AAAARecords)+len(result.CNAMEChain) == 0 {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Wildcard returns the wildcard verdict for zone, probing it unless it is
+// cached. It is nil when detection is off or the probes failed.
+func (r *Resolver) Wildcard(zone string) *database.WildcardZone {
+	if r.wildcard == nil {
+		return nil
+	}
+
+	timeout := r.config.ConnectionTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: timeout,
+	wz, _ := r.wildcard.Check(ctx, zone)
+	return wz
+}
+
+// provesNXDomain reports whether resp says name itself does not exist. With
+// a CNAME in the answer, NXDOMAIN is about the end of the chain instead.
+func provesNXDomain(resp *Msg, name string) bool {
+	if resp == nil || resp.Rcode != RcodeNXDomain {
+		return false
+	}
+	return len(followCNAMEs(name, resp.Answer)) == 0
+}
+
+// addressQuery picks the answered query that best describes the domain as a
+// whole: the address lookup, which carries every CNAME hop to the final name,
+// else the CNAME lookup. It returns -1 if none was answered.
+func addressQuery(queries []query, answered func(int) bool) int {
+	for _, want := range []uint16{TypeA, TypeAAAA, TypeCNAME} {
+		for i, q := range queries {
+			if q.qtype == want && q.service == "" && answered(i) {
+				return i
 			}
-			return d.DialContext(ctx, network, address)
-		},
+		}
+	}
+	return -1
+}
+
+// checkChain records the CNAME chain in chainResp and checks whether it
+// dangles.
+func (r *Resolver) checkChain(result *database.DomainResult, chainResp *Msg) {
+	result.CNAMEChain = followCNAMEs(result.Domain, chainResp.Answer)
+	nxdomain := chainResp.Rcode == RcodeNXDomain
+	addrs := append(append([]string(nil), result.ARecords...), result.AAAARecords...)
+	result.Dangling = r.dangling.Check(result.Domain, result.CNAMEChain, nxdomain, addrs)
+}
+
+// mergeSRVStatus folds the status of one service name into the SRV status.
+// Most services are not published, so NXDOMAIN there only means no data.
+func mergeSRVStatus(merged, status string) string {
+	if status == StatusNXDomain {
+		status = StatusNoData
+	}
+	switch {
+	case merged == StatusNoError || status == StatusNoError:
+		return StatusNoError
+	case merged == "" || merged == StatusNoData:
+		return status
 	}
+	return merged
+}
+
+// addAnswer copies the records answering q from resp into result, along
+// with the lowest TTL among them, and reports whether there were any.
+func addAnswer(result *database.DomainResult, q query, resp *Msg) bool {
+	owner := Fqdn(q.name)
+	var (
+		ttl   uint32
+		found bool
+	)
+
+	for _, rr := range resp.Answer {
+		if rr.Type != q.qtype {
+			continue
+		}
+		// Only addresses are wanted at the end of a CNAME chain, everything
+		// else belongs to the name itself
+		if q.qtype != TypeA && q.qtype != TypeAAAA && !strings.EqualFold(rr.Name, owner) {
+			continue
+		}
 
-	names, err := resolver.LookupAddr(ctx, ip)
+		switch data := rr.Data.(type) {
+		case *A:
+			result.ARecords = append(result.ARecords, data.IP.String())
+		case *AAAA:
+			result.AAAARecords = append(result.AAAARecords, data.IP.String())
+		case *CNAME:
+			result.CNAMERecords = append(result.CNAMERecords, strings.TrimSuffix(data.Target, "."))
+		case *MX:
+			result.MXRecords = append(result.MXRecords, strings.TrimSuffix(data.Host, "."))
+		case *NS:
+			result.NSRecords = append(result.NSRecords, strings.TrimSuffix(data.Host, "."))
+		case *TXT:
+			result.TXTRecords = append(result.TXTRecords, data.String())
+		case *SOA:
+			result.SOAPrimaryNS = strings.TrimSuffix(data.MName, ".")
+			result.SOAAdmin = mailbox(data.RName)
+			result.SOASerial = data.Serial
+		case *CAA:
+			result.CAARecords = append(result.CAARecords, data.String())
+		case *SRV:
+			result.SRVRecords = append(result.SRVRecords, fmt.Sprintf("%s %d %d %d %s",
+				q.service, data.Priority, data.Weight, data.Port, strings.TrimSuffix(data.Target, ".")))
+		case *DS:
+			result.HasDS = true
+		case *DNSKEY:
+			result.HasDNSKEY = true
+		case *SVCB:
+			if rr.Type == TypeHTTPS {
+				result.HTTPSRecords = append(result.HTTPSRecords, data.String())
+			} else {
+				result.SVCBRecords = append(result.SVCBRecords, data.String())
+			}
+			result.ALPN = appendUnique(result.ALPN, data.ALPN()...)
+		default:
+			continue
+		}
+
+		if !found || rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+		found = true
+	}
+
+	if found {
+		name := TypeString(q.qtype)
+		if old, ok := result.TTLs[name]; !ok || ttl < old {
+			result.TTLs[name] = ttl
+		}
+	}
+	return found
+}
+
+// mailbox turns an SOA RNAME such as hostmaster.example.com. into an address.
+func mailbox(rname string) string {
+	rname = strings.TrimSuffix(rname, ".")
+	// A backslash-escaped dot belongs to the local part
+	for i := 0; i < len(rname); i++ {
+		switch rname[i] {
+		case '\\':
+			i++
+		case '.':
+			return strings.ReplaceAll(rname[:i], "\\.", ".") + "@" + rname[i+1:]
+		}
+	}
+	return rname
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		seen := false
+		for _, existing := range list {
+			if existing == v {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func (r *Resolver) ReverseLookup(ip string) (string, error) {
+	names, err := r.ReverseLookupAll(ip)
 	if err != nil {
 		return "", err
 	}
 
 	if len(names) > 0 {
-		return strings.TrimSuffix(names[0], "."), nil
+		return names[0], nil
 	}
 
 	return "", nil
-}
\ No newline at end of file
+}
+
+// ReverseLookupAll returns every PTR name published for the address.
+func (r *Resolver) ReverseLookupAll(ip string) ([]string, error) {
+	timeout := r.config.ConnectionTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	arpa, err := ReverseName(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := r.lookup(ctx, arpa, TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.Data.(*PTR); ok {
+			names = append(names, strings.TrimSuffix(ptr.Host, "."))
+		}
+	}
+
+	return names, nil
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name for an address.
+func ReverseName(ip string) (string, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	if v4 := addr.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(addr) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[addr[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[addr[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lookup outcomes stored per record type
+const (
+	StatusNoError  = "NOERROR"  // Records of the type were returned
+	StatusNoData   = "NODATA"   // The name exists but has no records of the type
+	StatusNXDomain = "NXDOMAIN" // The name does not exist
+	StatusServFail = "SERVFAIL"
+	StatusRefused  = "REFUSED"
+	StatusTimeout  = "TIMEOUT"
+	StatusError    = "ERROR" // Any other failure, e.g. FORMERR or an unreachable upstream
+)
+
+// lookupStatus reduces the outcome of one query to a status. found says
+// whether the answer held records of the queried type.
+func lookupStatus(resp *Msg, err error, found bool) string {
+	if resp != nil {
+		switch resp.Rcode {
+		case RcodeSuccess:
+			if found {
+				return StatusNoError
+			}
+			return StatusNoData
+		case RcodeNXDomain:
+			return StatusNXDomain
+		case RcodeServFail:
+			return StatusServFail
+		case RcodeRefused:
+			return StatusRefused
+		}
+		return StatusError
+	}
+
+	if ClassifyError(err) == ErrorClassTimeout {
+		return StatusTimeout
+	}
+	return StatusError
+}
+
+// IsFailure reports whether a status means the lookup did not get an answer.
+// NXDOMAIN is a definitive answer, not a failure.
+func IsFailure(status string) bool {
+	switch status {
+	case StatusNoError, StatusNoData, StatusNXDomain, "":
+		return false
+	}
+	return true
+}
+
+// LookupError reports the record types of a domain whose lookups failed.
+// Err is the cause of a failed address lookup, if that was one of them.
+type LookupError struct {
+	Domain   string
+	Statuses map[string]string // Failing types only
+	Err      error
+}
+
+func (e *LookupError) Error() string {
+	types := make([]string, 0, len(e.Statuses))
+	for t := range e.Statuses {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	failures := make([]string, len(types))
+	for i, t := range types {
+		failures[i] = t + "=" + e.Statuses[t]
+	}
+	msg := fmt.Sprintf("lookup of %s failed: %s", e.Domain, strings.Join(failures, ", "))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
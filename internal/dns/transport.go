@@ -0,0 +1,333 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dotDefaultPort = "853"
+	dohMediaType   = "application/dns-message"
+
+	// Largest DNS message; DoH bodies are not read past it
+	maxMsgSize = 65535
+)
+
+// DoH request methods, RFC 8484 section 4.1
+const (
+	DoHPost = "POST"
+	DoHGet  = "GET"
+)
+
+var errConnClosed = errors.New("dns: connection closed")
+
+// transport carries queries to an upstream that is not plain DNS on port 53.
+type transport interface {
+	exchange(ctx context.Context, query *Msg) (*Msg, error)
+}
+
+// newTransport returns the transport for an upstream written as
+// tls://host[:port][#server-name] (DoT) or https://host/path (DoH), or nil
+// for a plain host[:port].
+func newTransport(addr string, opts PoolOptions) (transport, error) {
+	switch {
+	case strings.HasPrefix(addr, "tls://"):
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("missing host")
+		}
+
+		port := u.Port()
+		if port == "" {
+			port = dotDefaultPort
+		}
+		config := tlsConfig(opts.TLSConfig)
+		config.ServerName = u.Hostname()
+		if u.Fragment != "" {
+			config.ServerName = u.Fragment
+		}
+		return &dotTransport{addr: net.JoinHostPort(u.Hostname(), port), tlsConfig: config}, nil
+
+	case strings.HasPrefix(addr, "https://"):
+		if _, err := url.Parse(addr); err != nil {
+			return nil, err
+		}
+		return newDoHTransport(addr, opts), nil
+	}
+	return nil, nil
+}
+
+func tlsConfig(base *tls.Config) *tls.Config {
+	if base == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return base.Clone()
+}
+
+// dotTransport sends queries over DNS-over-TLS (RFC 7858), keeping one
+// connection open and pipelining queries on it.
+type dotTransport struct {
+	addr      string
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	pipe *pipeline
+}
+
+func (t *dotTransport) exchange(ctx context.Context, query *Msg) (*Msg, error) {
+	for attempt := 0; ; attempt++ {
+		pipe, err := t.pipeline(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := pipe.exchange(ctx, query)
+		// Servers close idle connections; a fresh one gets a second try
+		if errors.Is(err, errConnClosed) && attempt == 0 && ctx.Err() == nil {
+			continue
+		}
+		return resp, err
+	}
+}
+
+// pipeline returns the open connection, dialling one if there is none.
+func (t *dotTransport) pipeline(ctx context.Context) (*pipeline, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pipe != nil && !t.pipe.closed() {
+		return t.pipe, nil
+	}
+
+	d := tls.Dialer{Config: t.tlsConfig}
+	conn, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	t.pipe = newPipeline(conn)
+	return t.pipe, nil
+}
+
+// pipeline multiplexes queries over one stream connection. Responses may come
+// back in any order and are matched to queries by ID, RFC 7766 section 6.2.1.1.
+type pipeline struct {
+	conn     net.Conn
+	writeMu  sync.Mutex
+	lastRead int64 // Unix nanoseconds of the last response
+
+	mu      sync.Mutex
+	pending map[uint16]*pendingQuery
+	err     error
+	done    chan struct{}
+}
+
+type pendingQuery struct {
+	query *Msg
+	resp  chan *Msg
+}
+
+func newPipeline(conn net.Conn) *pipeline {
+	p := &pipeline{
+		conn:    conn,
+		pending: make(map[uint16]*pendingQuery),
+		done:    make(chan struct{}),
+	}
+	go p.read()
+	return p
+}
+
+func (p *pipeline) exchange(ctx context.Context, query *Msg) (*Msg, error) {
+	call := &pendingQuery{query: query, resp: make(chan *Msg, 1)}
+
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return nil, p.err
+	}
+	for {
+		query.ID = randomID()
+		if _, busy := p.pending[query.ID]; !busy {
+			break
+		}
+	}
+	p.pending[query.ID] = call
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		if p.pending[query.ID] == call {
+			delete(p.pending, query.ID)
+		}
+		p.mu.Unlock()
+	}()
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, len(packed)+2), uint16(len(packed)))
+	framed = append(framed, packed...)
+
+	sent := time.Now().UnixNano()
+	p.writeMu.Lock()
+	deadline, _ := ctx.Deadline()
+	p.conn.SetWriteDeadline(deadline)
+	_, err = p.conn.Write(framed)
+	p.writeMu.Unlock()
+	if err != nil {
+		p.fail(err)
+		return nil, p.err
+	}
+
+	select {
+	case resp := <-call.resp:
+		return resp, nil
+	case <-p.done:
+		return nil, p.err
+	case <-ctx.Done():
+		// Nothing came back on the connection since we wrote, so it is
+		// probably dead rather than the answer being slow
+		if atomic.LoadInt64(&p.lastRead) < sent {
+			p.fail(ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (p *pipeline) read() {
+	for {
+		resp, err := readStreamMsg(p.conn)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		atomic.StoreInt64(&p.lastRead, time.Now().UnixNano())
+
+		p.mu.Lock()
+		call, ok := p.pending[resp.ID]
+		if ok {
+			delete(p.pending, resp.ID)
+		}
+		p.mu.Unlock()
+
+		if ok && matches(call.query, resp) {
+			call.resp <- resp
+		}
+	}
+}
+
+// fail closes the connection and fails every query waiting on it.
+func (p *pipeline) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return
+	}
+	p.err = fmt.Errorf("%w: %v", errConnClosed, err)
+	close(p.done)
+	p.conn.Close()
+}
+
+func (p *pipeline) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// dohTransport sends queries over DNS-over-HTTPS (RFC 8484). The HTTP client
+// keeps connections alive and multiplexes queries over HTTP/2.
+type dohTransport struct {
+	url    string
+	get    bool
+	client *http.Client
+}
+
+func newDoHTransport(endpoint string, opts PoolOptions) *dohTransport {
+	return &dohTransport{
+		url: endpoint,
+		get: strings.EqualFold(opts.DoHMethod, DoHGet),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     tlsConfig(opts.TLSConfig),
+				ForceAttemptHTTP2:   true,
+				MaxIdleConnsPerHost: 64,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+func (t *dohTransport) exchange(ctx context.Context, query *Msg) (*Msg, error) {
+	// ID 0 keeps responses cacheable by HTTP caches, RFC 8484 section 4.1
+	query.ID = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if t.get {
+		u, err := url.Parse(t.url)
+		if err != nil {
+			return nil, err
+		}
+		params := u.Query()
+		params.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+		u.RawQuery = params.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(packed))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", dohMediaType)
+	}
+	req.Header.Set("Accept", dohMediaType)
+
+	httpResp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(httpResp.Body, maxMsgSize))
+		return nil, fmt.Errorf("dns: %s answered HTTP %d", t.url, httpResp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, err
+	}
+	if !matches(query, resp) {
+		return nil, errMismatch
+	}
+	return resp, nil
+}
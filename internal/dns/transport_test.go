@@ -0,0 +1,278 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// answer builds the response a stand-in server gives to query: one A record.
+func answer(t *testing.T, query *Msg) []byte {
+	t.Helper()
+	resp := &Msg{
+		Header:   Header{ID: query.ID, Response: true, RecursionDesired: query.RecursionDesired},
+		Question: query.Question,
+		Answer: []RR{{
+			Name:  query.Question[0].Name,
+			Type:  TypeA,
+			Class: ClassINET,
+			TTL:   300,
+			Data:  &A{IP: net.IPv4(192, 0, 2, 1)},
+		}},
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Errorf("packing response: %v", err)
+	}
+	return packed
+}
+
+// expectA checks resp carries the stand-in's answer for name.
+func expectA(t *testing.T, resp *Msg, name string) {
+	t.Helper()
+	if len(resp.Answer) != 1 || resp.Answer[0].Name != Fqdn(name) {
+		t.Errorf("answer for %s = %v", name, resp.Answer)
+		return
+	}
+	if a, ok := resp.Answer[0].Data.(*A); !ok || !a.IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("answer data for %s = %v", name, resp.Answer[0].Data)
+	}
+}
+
+func TestDoH(t *testing.T) {
+	for _, method := range []string{DoHGet, DoHPost} {
+		t.Run(method, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if r.Method != method {
+					t.Errorf("method = %s, want %s", r.Method, method)
+				}
+				if got := r.Header.Get("Accept"); got != dohMediaType {
+					t.Errorf("Accept = %q", got)
+				}
+
+				var body []byte
+				if method == DoHGet {
+					var err error
+					if body, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns")); err != nil {
+						t.Errorf("dns parameter: %v", err)
+					}
+				} else {
+					if got := r.Header.Get("Content-Type"); got != dohMediaType {
+						t.Errorf("Content-Type = %q", got)
+					}
+					body, _ = io.ReadAll(r.Body)
+				}
+
+				query := new(Msg)
+				if err := query.Unpack(body); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if query.ID != 0 {
+					t.Errorf("query ID = %d, want 0", query.ID)
+				}
+				w.Header().Set("Content-Type", dohMediaType)
+				w.Write(answer(t, query))
+			}))
+			defer srv.Close()
+
+			tr := newDoHTransport(srv.URL+"/dns-query", PoolOptions{
+				DoHMethod: method,
+				TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig,
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := tr.exchange(ctx, NewQuery("example.com", TypeA))
+			if err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+			expectA(t, resp, "example.com")
+			if atomic.LoadInt32(&requests) != 1 {
+				t.Fatalf("server saw %d requests", requests)
+			}
+		})
+	}
+}
+
+func TestDoHStatus(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tr := newDoHTransport(srv.URL, PoolOptions{TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig})
+	if _, err := tr.exchange(context.Background(), NewQuery("example.com", TypeA)); err == nil {
+		t.Fatal("exchange succeeded against an HTTP 503")
+	}
+}
+
+// testCertificate returns a self-signed certificate for dot.test and a pool
+// trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dot.test"},
+		DNSNames:              []string{"dot.test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func writeFramed(conn net.Conn, packed []byte) error {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+	_, err := conn.Write(append(framed, packed...))
+	return err
+}
+
+// TestDoTPipelineReconnect runs queries against a DoT stand-in whose first
+// connection answers three pipelined queries in reverse order and then drops
+// the next one unanswered. The client must match the answers by ID and retry
+// the dropped query on a new connection.
+func TestDoTPipelineReconnect(t *testing.T) {
+	const pipelined = 3
+
+	cert, roots := testCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var conns int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			n := atomic.AddInt32(&conns, 1)
+			go func(conn net.Conn, first bool) {
+				defer conn.Close()
+				if !first {
+					for {
+						query, err := readStreamMsg(conn)
+						if err != nil {
+							return
+						}
+						writeFramed(conn, answer(t, query))
+					}
+				}
+
+				var queries []*Msg
+				for len(queries) < pipelined {
+					query, err := readStreamMsg(conn)
+					if err != nil {
+						return
+					}
+					queries = append(queries, query)
+				}
+				for i := len(queries) - 1; i >= 0; i-- {
+					writeFramed(conn, answer(t, queries[i]))
+				}
+				// Read the next query and hang up without answering it
+				readStreamMsg(conn)
+			}(conn, n == 1)
+		}
+	}()
+
+	tr, err := newTransport("tls://"+ln.Addr().String()+"#dot.test", PoolOptions{TLSConfig: &tls.Config{RootCAs: roots}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	names := []string{"a.example", "b.example", "c.example"}
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			resp, err := tr.exchange(ctx, NewQuery(name, TypeA))
+			if err != nil {
+				t.Errorf("exchange %s: %v", name, err)
+				return
+			}
+			expectA(t, resp, name)
+		}(name)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+	if got := atomic.LoadInt32(&conns); got != 1 {
+		t.Fatalf("pipelined queries used %d connections, want 1", got)
+	}
+
+	resp, err := tr.exchange(ctx, NewQuery("d.example", TypeA))
+	if err != nil {
+		t.Fatalf("exchange after the connection closed: %v", err)
+	}
+	expectA(t, resp, "d.example")
+	if got := atomic.LoadInt32(&conns); got != 2 {
+		t.Fatalf("retry used %d connections in total, want 2", got)
+	}
+}
+
+// TestPipelineClosedError checks that queries on a dropped connection fail
+// with errConnClosed, which is what makes the transport redial.
+func TestPipelineClosedError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		readStreamMsg(server)
+		server.Close()
+	}()
+
+	pipe := newPipeline(client)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := pipe.exchange(ctx, NewQuery("example.com", TypeA))
+	if !errors.Is(err, errConnClosed) {
+		t.Fatalf("exchange error = %v, want errConnClosed", err)
+	}
+	if !pipe.closed() {
+		t.Fatal("pipeline not marked closed")
+	}
+}
@@ -0,0 +1,360 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCheckInterval = time.Minute
+	defaultEjectFor      = 5 * time.Minute
+	defaultMaxErrorRate  = 0.5
+	probeTimeout         = 3 * time.Second
+
+	// Queries an upstream must have answered in a window before its error
+	// rate counts, so a single early timeout does not eject it
+	minWindowQueries = 20
+
+	// Probes in a row that must fail before an upstream is ejected; a lie
+	// about a nonexistent name ejects it at once
+	maxProbeFailures = 3
+)
+
+// ErrNoUpstreams is returned by a pool created without any upstream.
+var ErrNoUpstreams = errors.New("dns: no upstream resolvers")
+
+// UpstreamStats is a snapshot of one upstream's health.
+type UpstreamStats struct {
+	Addr       string
+	Queries    int64
+	Errors     int64
+	ErrorRate  float64 // Over the current health window
+	AvgLatency time.Duration
+	Healthy    bool
+	Reason     string // Why it was ejected
+}
+
+type upstream struct {
+	addr      string
+	transport transport // nil for plain DNS
+	limiter   *limiter
+
+	queries      int64
+	errors       int64
+	totalLatency int64 // Nanoseconds, over answered queries
+
+	mu            sync.Mutex
+	windowQueries int
+	windowErrors  int
+	probeFailures int // Consecutive probes that failed
+	ejectedUntil  time.Time
+	reason        string
+}
+
+// UpstreamPool spreads queries over upstream resolvers round-robin, skips
+// ejected ones and keeps each under its QPS ceiling. Upstreams are ejected
+// for a while when their error rate is too high or when they answer a query
+// for a name that cannot exist, which is how NXDOMAIN hijacking shows.
+type UpstreamPool struct {
+	upstreams     []*upstream
+	next          uint32
+	checkInterval time.Duration
+	ejectFor      time.Duration
+	maxErrorRate  float64
+
+	probeOnce sync.Once
+	checking  int32
+	lastCheck int64 // Unix nanoseconds
+	client    *Client
+}
+
+type PoolOptions struct {
+	QPS           int // Per upstream, 0 for no limit
+	CheckInterval time.Duration
+	EjectFor      time.Duration
+	MaxErrorRate  float64
+	DoHMethod     string      // DoHPost or DoHGet
+	TLSConfig     *tls.Config // For DoT and DoH upstreams; nil uses the system roots
+}
+
+func NewUpstreamPool(addrs []string, opts PoolOptions) *UpstreamPool {
+	p := &UpstreamPool{
+		checkInterval: opts.CheckInterval,
+		ejectFor:      opts.EjectFor,
+		maxErrorRate:  opts.MaxErrorRate,
+	}
+	if p.checkInterval <= 0 {
+		p.checkInterval = defaultCheckInterval
+	}
+	if p.ejectFor <= 0 {
+		p.ejectFor = defaultEjectFor
+	}
+	if p.maxErrorRate <= 0 {
+		p.maxErrorRate = defaultMaxErrorRate
+	}
+
+	for _, addr := range addrs {
+		t, err := newTransport(addr, opts)
+		if err != nil {
+			log.Printf("Ignoring DNS upstream %q: %v", addr, err)
+			continue
+		}
+		if t == nil {
+			addr = withDefaultPort(addr)
+		}
+		p.upstreams = append(p.upstreams, &upstream{
+			addr:      addr,
+			transport: t,
+			limiter:   newLimiter(opts.QPS),
+		})
+	}
+	p.client = &Client{Timeout: probeTimeout, Attempts: 1}
+	return p
+}
+
+// pick returns the next healthy upstream, waiting for its rate limit. When
+// every upstream is ejected the one due back soonest is used anyway.
+func (p *UpstreamPool) pick(ctx context.Context) (*upstream, error) {
+	if len(p.upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	// The first probe runs before any query so a lying resolver never answers
+	p.probeOnce.Do(func() { p.check() })
+	p.maybeCheck()
+
+	now := time.Now()
+	var (
+		fallback      *upstream
+		fallbackUntil time.Time
+	)
+	for i := 0; i < len(p.upstreams); i++ {
+		u := p.upstreams[int(atomic.AddUint32(&p.next, 1)%uint32(len(p.upstreams)))]
+
+		u.mu.Lock()
+		until := u.ejectedUntil
+		u.mu.Unlock()
+
+		if now.After(until) {
+			return u, u.limiter.wait(ctx)
+		}
+		if fallback == nil || until.Before(fallbackUntil) {
+			fallback, fallbackUntil = u, until
+		}
+	}
+	return fallback, fallback.limiter.wait(ctx)
+}
+
+// report records the outcome of one query sent to u.
+func (p *UpstreamPool) report(u *upstream, latency time.Duration, resp *Msg, err error) {
+	failed := err != nil || resp == nil ||
+		resp.Rcode == RcodeServFail || resp.Rcode == RcodeRefused
+
+	atomic.AddInt64(&u.queries, 1)
+	if failed {
+		atomic.AddInt64(&u.errors, 1)
+	} else {
+		atomic.AddInt64(&u.totalLatency, int64(latency))
+	}
+
+	u.mu.Lock()
+	u.windowQueries++
+	if failed {
+		u.windowErrors++
+	}
+	u.mu.Unlock()
+}
+
+func (p *UpstreamPool) maybeCheck() {
+	last := time.Unix(0, atomic.LoadInt64(&p.lastCheck))
+	if time.Since(last) < p.checkInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&p.checking, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&p.checking, 0)
+		p.check()
+	}()
+}
+
+// check ends the current health window: upstreams with too many errors in
+// it are ejected, and every upstream is probed for NXDOMAIN hijacking.
+func (p *UpstreamPool) check() {
+	atomic.StoreInt64(&p.lastCheck, time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+
+			u.mu.Lock()
+			queries, errs := u.windowQueries, u.windowErrors
+			u.windowQueries, u.windowErrors = 0, 0
+			u.mu.Unlock()
+
+			if queries >= minWindowQueries {
+				if rate := float64(errs) / float64(queries); rate > p.maxErrorRate {
+					p.eject(u, fmt.Sprintf("%.0f%% of %d queries failed", rate*100, queries))
+					return
+				}
+			}
+
+			reason, hijacked := p.probe(u)
+			u.mu.Lock()
+			if reason == "" || hijacked {
+				u.probeFailures = 0
+			} else {
+				u.probeFailures++
+			}
+			failures := u.probeFailures
+			if failures >= maxProbeFailures {
+				u.probeFailures = 0
+			}
+			u.mu.Unlock()
+
+			switch {
+			case hijacked:
+				p.eject(u, reason)
+			case failures >= maxProbeFailures:
+				p.eject(u, fmt.Sprintf("%s, %d probes in a row", reason, failures))
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+// probe asks for a random name under .com, which must not exist. It returns
+// what went wrong, or "" if the upstream answered honestly, and whether it
+// lied rather than failed.
+func (p *UpstreamPool) probe(u *upstream) (string, bool) {
+	label := make([]byte, 10)
+	rand.Read(label)
+	name := "nx-" + hex.EncodeToString(label) + ".com."
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	resp, err := p.client.exchangeVia(ctx, u, NewQuery(name, TypeA))
+	if err != nil {
+		return fmt.Sprintf("probe failed: %v", err), false
+	}
+	if resp.Rcode == RcodeSuccess && len(resp.Answer) > 0 {
+		return fmt.Sprintf("answered nonexistent %s with %s, NXDOMAIN is hijacked", name, resp.Answer[0].Data), true
+	}
+	if resp.Rcode == RcodeServFail || resp.Rcode == RcodeRefused {
+		return "probe answered " + RcodeString(resp.Rcode), false
+	}
+	return "", false
+}
+
+func (p *UpstreamPool) eject(u *upstream, reason string) {
+	u.mu.Lock()
+	u.ejectedUntil = time.Now().Add(p.ejectFor)
+	u.reason = reason
+	u.mu.Unlock()
+
+	log.Printf("Ejecting DNS upstream %s for %v: %s", u.addr, p.ejectFor, reason)
+}
+
+// Stats returns a snapshot of every upstream.
+func (p *UpstreamPool) Stats() []UpstreamStats {
+	stats := make([]UpstreamStats, 0, len(p.upstreams))
+	now := time.Now()
+
+	for _, u := range p.upstreams {
+		s := UpstreamStats{
+			Addr:    u.addr,
+			Queries: atomic.LoadInt64(&u.queries),
+			Errors:  atomic.LoadInt64(&u.errors),
+		}
+		if answered := s.Queries - s.Errors; answered > 0 {
+			s.AvgLatency = time.Duration(atomic.LoadInt64(&u.totalLatency) / answered)
+		}
+
+		u.mu.Lock()
+		if u.windowQueries > 0 {
+			s.ErrorRate = float64(u.windowErrors) / float64(u.windowQueries)
+		}
+		s.Healthy = now.After(u.ejectedUntil)
+		if !s.Healthy {
+			s.Reason = u.reason
+		}
+		u.mu.Unlock()
+
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// limiter spaces calls evenly at qps per second. Each wait reserves the next
+// free slot; a wait that gives up returns its slot so that callers who
+// cancelled do not push back everyone queued after them.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(qps int) *limiter {
+	if qps <= 0 {
+		return &limiter{}
+	}
+	return &limiter{interval: time.Second / time.Duration(qps)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	// A slot after the deadline could never be used, so do not take it
+	if deadline, ok := ctx.Deadline(); ok && slot.After(deadline) {
+		l.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// cancel gives back a reserved slot that was not used.
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.next = l.next.Add(-l.interval)
+	if now := time.Now(); l.next.Before(now) {
+		l.next = now
+	}
+}
@@ -0,0 +1,368 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSSEC validation outcomes, RFC 4035 section 4.3
+const (
+	DNSSECSecure        = "secure"
+	DNSSECInsecure      = "insecure"
+	DNSSECBogus         = "bogus"
+	DNSSECIndeterminate = "indeterminate"
+)
+
+const (
+	// How long the outcome for a zone is reused before it is validated again
+	zoneStateTTL = time.Hour
+
+	// Zone outcomes kept before expired ones are swept out
+	maxZoneStates = 100000
+)
+
+//go:embed root-anchors.txt
+var rootAnchors []byte
+
+// zoneState is where validation stands after walking down to a name.
+type zoneState struct {
+	status  string
+	reason  string
+	zone    string    // Deepest zone at or above the name
+	keys    []*DNSKEY // Validated keys of zone when secure
+	final   bool      // Nothing below the name needs walking
+	expires time.Time
+}
+
+// Validator establishes the chain of trust from the root trust anchor down
+// to a domain, using DS, DNSKEY and RRSIG records fetched through lookup,
+// and checks the signature on the domain's own answer. Outcomes per zone are
+// cached, so the root and TLD keys are verified once an hour, not per domain.
+type Validator struct {
+	lookup  func(ctx context.Context, name string, qtype uint16) (*Msg, error)
+	anchors []*DS
+
+	mu     sync.RWMutex
+	states map[string]*zoneState
+}
+
+// NewValidator returns a validator anchored at the embedded root trust
+// anchors. lookup must return responses with their RRSIGs, see Client.DNSSEC.
+func NewValidator(lookup func(ctx context.Context, name string, qtype uint16) (*Msg, error)) *Validator {
+	return &Validator{
+		lookup:  lookup,
+		anchors: parseAnchors(rootAnchors),
+		states:  make(map[string]*zoneState),
+	}
+}
+
+// Validate returns the status of domain and, unless it is secure, why.
+// resp is the answer to the domain's address lookup, whose signature decides
+// the status once the chain down to the domain's zone is secure.
+func (v *Validator) Validate(ctx context.Context, domain string, resp *Msg) (status, reason string) {
+	name := strings.ToLower(Fqdn(domain))
+
+	state := v.chain(ctx, name)
+	if state.status != DNSSECSecure {
+		return state.status, state.reason
+	}
+	if resp == nil {
+		return DNSSECIndeterminate, "no answer to validate"
+	}
+	return checkAnswer(resp, name, state)
+}
+
+// chain walks from the deepest cached zone above name down to name, one
+// label at a time, looking for zone cuts.
+func (v *Validator) chain(ctx context.Context, name string) *zoneState {
+	var labels []string
+	if name != "." {
+		labels = strings.Split(strings.TrimSuffix(name, "."), ".")
+	}
+
+	state, next := v.cached(labels)
+	if state == nil {
+		state = v.root(ctx)
+		v.store(".", state)
+	}
+
+	for i := next; i >= 0 && state.status == DNSSECSecure && !state.final; i-- {
+		child := strings.Join(labels[i:], ".") + "."
+		state = v.descend(ctx, state, child)
+		v.store(child, state)
+	}
+	return state
+}
+
+// cached returns the state of the deepest name above or at labels that is
+// known, and the index of the label to continue with.
+func (v *Validator) cached(labels []string) (*zoneState, int) {
+	now := time.Now()
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for i := 0; i < len(labels); i++ {
+		if s, ok := v.states[strings.Join(labels[i:], ".")+"."]; ok && now.Before(s.expires) {
+			return s, i - 1
+		}
+	}
+	if s, ok := v.states["."]; ok && now.Before(s.expires) {
+		return s, len(labels) - 1
+	}
+	return nil, len(labels) - 1
+}
+
+// store caches state for name, except when it is indeterminate, which says
+// more about the network than about the zone.
+func (v *Validator) store(name string, state *zoneState) {
+	if state.status == DNSSECIndeterminate {
+		return
+	}
+	state.expires = time.Now().Add(zoneStateTTL)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.states) >= maxZoneStates {
+		now := time.Now()
+		for key, old := range v.states {
+			if !now.Before(old.expires) {
+				delete(v.states, key)
+			}
+		}
+		if len(v.states) >= maxZoneStates {
+			v.states = make(map[string]*zoneState)
+		}
+	}
+	v.states[name] = state
+}
+
+// root validates the root DNSKEY set against the trust anchors.
+func (v *Validator) root(ctx context.Context) *zoneState {
+	keys, state := v.zoneKeys(ctx, ".", v.anchors)
+	if state != nil {
+		return state
+	}
+	return &zoneState{status: DNSSECSecure, zone: ".", keys: keys}
+}
+
+// descend looks for a zone cut at child below the secure zone of parent.
+func (v *Validator) descend(ctx context.Context, parent *zoneState, child string) *zoneState {
+	resp, err := v.lookup(ctx, child, TypeDS)
+	if resp == nil || (resp.Rcode != RcodeSuccess && resp.Rcode != RcodeNXDomain) {
+		return indeterminate(fmt.Sprintf("DS lookup for %s failed: %v", child, err))
+	}
+
+	sets := groupRRsets(resp.Answer)
+	// A CNAME owner cannot be a zone cut, nor have names below it
+	if findRRset(sets, child, TypeCNAME) != nil {
+		return &zoneState{status: DNSSECSecure, zone: parent.zone, keys: parent.keys, final: true}
+	}
+
+	ds := findRRset(sets, child, TypeDS)
+	if ds == nil || len(ds.rrs) == 0 {
+		return denial(parent, child, resp)
+	}
+	if err := verifyRRset(ds.rrs, ds.sigs, parent.keys, parent.zone, time.Now()); err != nil {
+		return bogus(fmt.Sprintf("DS of %s: %v", child, err))
+	}
+
+	var usable []*DS
+	for _, rr := range ds.rrs {
+		d := rr.Data.(*DS)
+		switch d.DigestType {
+		case DigestSHA1, DigestSHA256, DigestSHA384:
+			if supportedAlgorithm(d.Algorithm) {
+				usable = append(usable, d)
+			}
+		}
+	}
+	// RFC 4035 section 5.2: a zone signed only with unknown algorithms is
+	// treated as unsigned
+	if len(usable) == 0 {
+		return &zoneState{status: DNSSECInsecure, reason: fmt.Sprintf("DS of %s only uses unsupported algorithms", child),
+			zone: child, final: true}
+	}
+
+	keys, state := v.zoneKeys(ctx, child, usable)
+	if state != nil {
+		return state
+	}
+	return &zoneState{status: DNSSECSecure, zone: child, keys: keys}
+}
+
+// zoneKeys fetches the DNSKEY set of zone and validates it with a key that
+// one of dss vouches for. On failure the returned state says why.
+func (v *Validator) zoneKeys(ctx context.Context, zone string, dss []*DS) ([]*DNSKEY, *zoneState) {
+	resp, err := v.lookup(ctx, zone, TypeDNSKEY)
+	if resp == nil || resp.Rcode != RcodeSuccess {
+		return nil, indeterminate(fmt.Sprintf("DNSKEY lookup for %s failed: %v", zone, err))
+	}
+
+	set := findRRset(groupRRsets(resp.Answer), zone, TypeDNSKEY)
+	if set == nil || len(set.rrs) == 0 {
+		return nil, bogus(fmt.Sprintf("%s has a DS record but no DNSKEY", zone))
+	}
+
+	var keys, anchored []*DNSKEY
+	for _, rr := range set.rrs {
+		key := rr.Data.(*DNSKEY)
+		keys = append(keys, key)
+		for _, ds := range dss {
+			if matchesDS(zone, key, ds) {
+				anchored = append(anchored, key)
+				break
+			}
+		}
+	}
+	if len(anchored) == 0 {
+		return nil, bogus(fmt.Sprintf("no DNSKEY of %s matches its DS", zone))
+	}
+	if err := verifyRRset(set.rrs, set.sigs, anchored, zone, time.Now()); err != nil {
+		return nil, bogus(fmt.Sprintf("DNSKEY set of %s: %v", zone, err))
+	}
+	return keys, nil
+}
+
+// denial reads the signed NSEC or NSEC3 proof in a DS response without DS
+// records: child is either an unsigned delegation, which makes everything
+// below it insecure, or not a zone cut at all.
+func denial(parent *zoneState, child string, resp *Msg) *zoneState {
+	sameZone := &zoneState{status: DNSSECSecure, zone: parent.zone, keys: parent.keys}
+
+	proven := false
+	for _, s := range groupRRsets(resp.Authority) {
+		if s.rtype != TypeNSEC && s.rtype != TypeNSEC3 {
+			continue
+		}
+		if err := verifyRRset(s.rrs, s.sigs, parent.keys, parent.zone, time.Now()); err != nil {
+			return bogus(fmt.Sprintf("denial of DS at %s: %v", child, err))
+		}
+		proven = true
+
+		var types []uint16
+		switch data := s.rrs[0].Data.(type) {
+		case *NSEC:
+			if s.name != child {
+				continue
+			}
+			types = data.Types
+		case *NSEC3:
+			if data.Hash != nsec3HashSHA1 {
+				return indeterminate(fmt.Sprintf("unknown NSEC3 hash algorithm %d", data.Hash))
+			}
+			owner, err := base32Hex.DecodeString(strings.ToUpper(strings.SplitN(s.name, ".", 2)[0]))
+			if err != nil {
+				continue
+			}
+			hash := nsec3Hash(child, data.Salt, data.Iterations)
+			if !bytes.Equal(owner, hash) {
+				if data.Flags&nsec3OptOut != 0 && nsec3Covers(owner, data.NextHashed, hash) {
+					return &zoneState{status: DNSSECInsecure, reason: fmt.Sprintf("%s is in an NSEC3 opt-out span of %s", child, parent.zone),
+						zone: parent.zone, final: true}
+				}
+				continue
+			}
+			types = data.Types
+		}
+
+		switch {
+		case hasBitmapType(types, TypeDS):
+			return bogus(fmt.Sprintf("denial for %s lists a DS record", child))
+		case hasBitmapType(types, TypeNS) && !hasBitmapType(types, TypeSOA):
+			return &zoneState{status: DNSSECInsecure, reason: fmt.Sprintf("unsigned delegation to %s", child),
+				zone: child, final: true}
+		}
+		return sameZone
+	}
+
+	if !proven {
+		return bogus(fmt.Sprintf("no signed proof that %s has no DS", child))
+	}
+	// The name does not exist, so nothing below it does either
+	if resp.Rcode == RcodeNXDomain {
+		sameZone.final = true
+	}
+	// Otherwise an empty non-terminal, covered by an NSEC instead of matched
+	return sameZone
+}
+
+// checkAnswer validates the records of name in resp, or for a negative
+// answer the SOA that comes with it, with the keys of the name's zone.
+func checkAnswer(resp *Msg, name string, state *zoneState) (string, string) {
+	now := time.Now()
+
+	for _, s := range groupRRsets(resp.Answer) {
+		if s.name != name || len(s.rrs) == 0 {
+			continue
+		}
+		if err := verifyRRset(s.rrs, s.sigs, state.keys, state.zone, now); err != nil {
+			return DNSSECBogus, fmt.Sprintf("%s %s: %v", strings.TrimSuffix(name, "."), TypeString(s.rtype), err)
+		}
+		return DNSSECSecure, ""
+	}
+
+	for _, s := range groupRRsets(resp.Authority) {
+		if s.rtype != TypeSOA || len(s.rrs) == 0 {
+			continue
+		}
+		if err := verifyRRset(s.rrs, s.sigs, state.keys, state.zone, now); err != nil {
+			return DNSSECBogus, fmt.Sprintf("SOA of negative answer: %v", err)
+		}
+		return DNSSECSecure, ""
+	}
+	return DNSSECIndeterminate, "answer has neither records nor an SOA to validate"
+}
+
+func findRRset(sets []*rrset, name string, rtype uint16) *rrset {
+	for _, s := range sets {
+		if s.name == name && s.rtype == rtype {
+			return s
+		}
+	}
+	return nil
+}
+
+func bogus(reason string) *zoneState {
+	return &zoneState{status: DNSSECBogus, reason: reason, final: true}
+}
+
+func indeterminate(reason string) *zoneState {
+	return &zoneState{status: DNSSECIndeterminate, reason: reason, final: true}
+}
+
+// parseAnchors reads DS records in zone file form, one per line.
+func parseAnchors(data []byte) []*DS {
+	var anchors []*DS
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 7 || fields[0] != "." || fields[2] != "DS" {
+			continue
+		}
+		tag, err1 := strconv.ParseUint(fields[3], 10, 16)
+		alg, err2 := strconv.ParseUint(fields[4], 10, 8)
+		digestType, err3 := strconv.ParseUint(fields[5], 10, 8)
+		digest, err4 := hex.DecodeString(fields[6])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		anchors = append(anchors, &DS{
+			KeyTag:     uint16(tag),
+			Algorithm:  uint8(alg),
+			DigestType: uint8(digestType),
+			Digest:     digest,
+		})
+	}
+	return anchors
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+)
+
+const (
+	// How long a zone's verdict is reused before probing it again
+	wildcardTTL = 6 * time.Hour
+
+	// Verdicts kept before expired ones are swept out
+	maxWildcardZones = 100000
+)
+
+type wildcardEntry struct {
+	done    chan struct{} // Closed once zone is set
+	zone    *database.WildcardZone
+	expires time.Time
+}
+
+// WildcardDetector tells whether a zone answers for names that do not exist,
+// by resolving random labels under it. Verdicts are cached per zone, and
+// concurrent checks of one zone share a single round of probes.
+type WildcardDetector struct {
+	lookup func(ctx context.Context, name string, qtype uint16) (*Msg, error)
+	probes int
+
+	mu    sync.Mutex
+	zones map[string]*wildcardEntry
+}
+
+func NewWildcardDetector(probes int, lookup func(ctx context.Context, name string, qtype uint16) (*Msg, error)) *WildcardDetector {
+	return &WildcardDetector{
+		lookup: lookup,
+		probes: probes,
+		zones:  make(map[string]*wildcardEntry),
+	}
+}
+
+// Check returns the verdict for zone and whether it was probed just now, as
+// opposed to coming from the cache. It returns nil when the probes failed.
+func (w *WildcardDetector) Check(ctx context.Context, zone string) (*database.WildcardZone, bool) {
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	now := time.Now()
+
+	w.mu.Lock()
+	if entry, ok := w.zones[zone]; ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		w.mu.Unlock()
+		select {
+		case <-entry.done:
+			return entry.zone, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	w.sweep(now)
+	entry := &wildcardEntry{done: make(chan struct{})}
+	w.zones[zone] = entry
+	w.mu.Unlock()
+
+	entry.zone = w.probe(ctx, zone)
+
+	w.mu.Lock()
+	if entry.zone == nil {
+		// Try again next time rather than caching a network failure
+		delete(w.zones, zone)
+	} else {
+		entry.expires = time.Now().Add(wildcardTTL)
+	}
+	w.mu.Unlock()
+	close(entry.done)
+
+	return entry.zone, true
+}
+
+// probe resolves the A and AAAA records of random labels under zone. Any
+// answer means a wildcard; the addresses and CNAME targets seen make up its
+// fingerprint.
+func (w *WildcardDetector) probe(ctx context.Context, zone string) *database.WildcardZone {
+	type outcome struct {
+		addrs  []string
+		target string
+		ok     bool
+	}
+	outcomes := make([]outcome, w.probes*2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.probes; i++ {
+		name := randomLabel() + "." + zone
+		for j, qtype := range []uint16{TypeA, TypeAAAA} {
+			wg.Add(1)
+			go func(slot int, name string, qtype uint16) {
+				defer wg.Done()
+
+				// Random labels are never asked again; caching them only evicts real answers
+				resp, _ := w.lookup(withoutCache(ctx), name, qtype)
+				if resp == nil || (resp.Rcode != RcodeSuccess && resp.Rcode != RcodeNXDomain) {
+					return
+				}
+				o := outcome{ok: true}
+				for _, rr := range resp.Answer {
+					switch data := rr.Data.(type) {
+					case *A:
+						o.addrs = append(o.addrs, data.IP.String())
+					case *AAAA:
+						o.addrs = append(o.addrs, data.IP.String())
+					}
+				}
+				if chain := followCNAMEs(name, resp.Answer); len(chain) > 0 {
+					o.target = strings.ToLower(chain[len(chain)-1])
+				}
+				outcomes[slot] = o
+			}(i*2+j, name, qtype)
+		}
+	}
+	wg.Wait()
+
+	wz := &database.WildcardZone{Zone: zone, Probes: w.probes, CheckedAt: time.Now()}
+	for _, o := range outcomes {
+		if !o.ok {
+			return nil
+		}
+		if len(o.addrs) > 0 || o.target != "" {
+			wz.Wildcard = true
+		}
+		wz.Addresses = appendUnique(wz.Addresses, o.addrs...)
+		if o.target != "" {
+			wz.CNAMEs = appendUnique(wz.CNAMEs, o.target)
+		}
+	}
+	sort.Strings(wz.Addresses)
+	sort.Strings(wz.CNAMEs)
+	return wz
+}
+
+// sweep drops expired verdicts once the cache is full. Callers hold w.mu.
+func (w *WildcardDetector) sweep(now time.Time) {
+	if len(w.zones) < maxWildcardZones {
+		return
+	}
+	for zone, entry := range w.zones {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			delete(w.zones, zone)
+		}
+	}
+	if len(w.zones) >= maxWildcardZones {
+		for zone, entry := range w.zones {
+			// Leave probes in flight alone; their waiters hold the entry
+			if !entry.expires.IsZero() {
+				delete(w.zones, zone)
+			}
+		}
+	}
+}
+
+// MatchesWildcard reports whether a domain's answers are what the wildcard
+// of its zone hands out: its CNAME chain ends at a wildcard target, or every
+// address it has is a wildcard address.
+func MatchesWildcard(result *database.DomainResult, wz *database.WildcardZone) bool {
+	if wz == nil || !wz.Wildcard || strings.EqualFold(result.Domain, wz.Zone) {
+		return false
+	}
+
+	if n := len(result.CNAMEChain); n > 0 {
+		target := strings.ToLower(result.CNAMEChain[n-1])
+		for _, t := range wz.CNAMEs {
+			if t == target {
+				return true
+			}
+		}
+	}
+
+	addrs := append(append([]string(nil), result.ARecords...), result.AAAARecords...)
+	if len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		found := false
+		for _, w := range wz.Addresses {
+			if w == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// randomLabel returns a label that no zone plausibly publishes.
+func randomLabel() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "wc-" + hex.EncodeToString(b)
+}
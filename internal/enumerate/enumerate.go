@@ -0,0 +1,150 @@
+// Package enumerate guesses subdomain names to try under a domain: labels
+// from a wordlist, and variations of labels already found to exist.
+package enumerate
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/recon-scanner/internal/normalize"
+)
+
+//go:embed wordlist.txt
+var defaultWordlist []byte
+
+// Environment names that deployments are commonly prefixed or suffixed with
+var environments = []string{"dev", "test", "qa", "uat", "stage", "staging", "preprod", "prod", "old", "new", "beta"}
+
+// Highest number appended to a label, e.g. api1 to api3
+const maxNumericSuffix = 3
+
+// Candidate is a name to try and where the guess came from.
+type Candidate struct {
+	Name string
+	From string // Parent domain for wordlist guesses, the existing name for permutations
+}
+
+// LoadWordlist reads one label per line from path, or returns the built-in
+// list when path is empty. Blank lines and lines starting with # are skipped.
+func LoadWordlist(path string) ([]string, error) {
+	data := defaultWordlist
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var words []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		word = strings.Trim(word, ".")
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words, scanner.Err()
+}
+
+// Wordlist returns a candidate for every word under parent. Words that do
+// not make a valid name are skipped.
+func Wordlist(parent string, words []string) []Candidate {
+	var candidates []Candidate
+	for _, word := range words {
+		if name, ok := join(word, parent); ok {
+			candidates = append(candidates, Candidate{Name: name, From: parent})
+		}
+	}
+	return candidates
+}
+
+// Permutations varies the first label of name, a host found under parent:
+// environment prefixes and suffixes (dev-api, api-staging), numbers (api2,
+// api-01), and the neighbours of a number the label already ends in.
+func Permutations(name, parent string) []Candidate {
+	rest := strings.TrimSuffix(name, "."+parent)
+	if rest == name || rest == "" {
+		return nil
+	}
+	label, below := rest, ""
+	if i := strings.IndexByte(rest, '.'); i >= 0 {
+		label, below = rest[:i], rest[i:]
+	}
+	base := stripEnvironment(label)
+
+	var labels []string
+	if base != label {
+		labels = append(labels, base)
+	}
+	for _, env := range environments {
+		labels = append(labels, env+"-"+base, base+"-"+env, env+"."+base)
+	}
+	for n := 1; n <= maxNumericSuffix; n++ {
+		labels = append(labels, base+strconv.Itoa(n), base+"-"+strconv.Itoa(n), base+"0"+strconv.Itoa(n))
+	}
+	if stem, n, ok := numbered(label); ok {
+		if n > 0 {
+			labels = append(labels, stem+strconv.Itoa(n-1))
+		}
+		labels = append(labels, stem+strconv.Itoa(n+1))
+	}
+
+	var candidates []Candidate
+	seen := map[string]bool{name: true}
+	for _, l := range labels {
+		candidate, ok := join(l+below, parent)
+		if !ok || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		candidates = append(candidates, Candidate{Name: candidate, From: name})
+	}
+	return candidates
+}
+
+// stripEnvironment removes one environment prefix or suffix, so dev-api
+// permutes as api does.
+func stripEnvironment(label string) string {
+	for _, env := range environments {
+		if base := strings.TrimPrefix(label, env+"-"); base != label && base != "" {
+			return base
+		}
+		if base := strings.TrimSuffix(label, "-"+env); base != label && base != "" {
+			return base
+		}
+	}
+	return label
+}
+
+// numbered splits a label like web2 into web and 2.
+func numbered(label string) (string, int, bool) {
+	i := len(label)
+	for i > 0 && label[i-1] >= '0' && label[i-1] <= '9' {
+		i--
+	}
+	if i == len(label) || i == 0 || len(label)-i > 4 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(label[i:])
+	if err != nil {
+		return "", 0, false
+	}
+	return label[:i], n, true
+}
+
+// join puts label in front of parent and normalizes the result.
+func join(label, parent string) (string, bool) {
+	name, err := normalize.Domain(label+"."+parent, normalize.Options{})
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,303 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/recon-scanner/internal/normalize"
+)
+
+// Input list formats
+const (
+	FormatAuto     = "auto"
+	FormatTranco   = "tranco"   // rank,domain
+	FormatUmbrella = "umbrella" // rank,domain
+	FormatMajestic = "majestic" // GlobalRank,TldRank,Domain,TLD,... with a header
+	FormatText     = "text"     // One domain per line
+)
+
+// StdinPath selects standard input instead of a file.
+const StdinPath = "-"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Source yields records one at a time. Next returns io.EOF once the input is exhausted.
+type Source interface {
+	Next() (Record, error)
+	Close() error
+}
+
+// layout says where the rank and domain live in each line.
+type layout struct {
+	delimited bool // Comma separated, otherwise the whole line is the domain
+	rankCol   int  // -1 when the list has no rank column
+	domainCol int
+}
+
+type lineSource struct {
+	reader  *bufio.Reader
+	closers []io.Closer
+	layout  layout
+	opts    Options
+
+	// First line, read ahead for format detection
+	first string
+
+	offset int64
+	line   int64
+	index  int
+}
+
+// Open opens a domain list, transparently decompressing gzip or zstd input
+// and detecting its layout when format is FormatAuto. Reading resumes at
+// opts.StartOffset, measured in decompressed bytes.
+func Open(path string, opts Options) (Source, error) {
+	src := &lineSource{
+		opts:  opts,
+		line:  opts.StartLine,
+		index: opts.StartIndex,
+	}
+
+	var raw io.Reader
+	if path == StdinPath {
+		raw = os.Stdin
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open input file: %w", err)
+		}
+		src.closers = append(src.closers, file)
+		raw = file
+	}
+
+	buffered := bufio.NewReaderSize(raw, 64*1024)
+	magic, _ := buffered.Peek(4)
+	compressed := true
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("failed to open gzip input: %w", err)
+		}
+		src.closers = append(src.closers, gz)
+		src.reader = bufio.NewReaderSize(gz, 64*1024)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("failed to open zstd input: %w", err)
+		}
+		src.closers = append(src.closers, zr.IOReadCloser())
+		src.reader = bufio.NewReaderSize(zr, 64*1024)
+	default:
+		compressed = false
+		src.reader = buffered
+	}
+
+	// The layout always comes from the top of the list, where any header is
+	first, err := src.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		src.Close()
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	src.layout, err = layoutFor(opts.Format, first)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	if opts.StartOffset == 0 {
+		src.first = first
+		return src, nil
+	}
+
+	// Resume: seek plain files, skip through anything that cannot seek
+	file, seekable := raw.(*os.File)
+	if seekable && !compressed && path != StdinPath {
+		if _, err := file.Seek(opts.StartOffset, io.SeekStart); err == nil {
+			src.reader.Reset(file)
+			src.offset = opts.StartOffset
+			return src, nil
+		}
+	}
+
+	if _, err := io.CopyN(io.Discard, src.reader, opts.StartOffset-int64(len(first))); err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to skip to offset %d: %w", opts.StartOffset, err)
+	}
+	src.offset = opts.StartOffset
+	return src, nil
+}
+
+func (s *lineSource) Next() (Record, error) {
+	for {
+		line, err := s.readLine()
+		if line == "" && err != nil {
+			return Record{}, err
+		}
+		s.line++
+
+		record, ok := s.parse(line)
+		if ok {
+			return record, nil
+		}
+	}
+}
+
+func (s *lineSource) readLine() (string, error) {
+	if s.first != "" {
+		line := s.first
+		s.first = ""
+		s.offset += int64(len(line))
+		return line, nil
+	}
+
+	line, err := s.reader.ReadString('\n')
+	s.offset += int64(len(line))
+	return line, err
+}
+
+func (s *lineSource) parse(line string) (Record, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Record{}, false
+	}
+
+	fields := []string{line}
+	if s.layout.delimited {
+		var ok bool
+		if fields, ok = splitCSV(line); !ok {
+			return Record{}, false
+		}
+	}
+	if s.layout.domainCol >= len(fields) {
+		return Record{}, false
+	}
+
+	var rank int64
+	if s.layout.rankCol >= 0 {
+		if s.layout.rankCol >= len(fields) {
+			return Record{}, false
+		}
+		parsed, err := strconv.ParseInt(unquote(fields[s.layout.rankCol]), 10, 64)
+		if err != nil {
+			return Record{}, false // Header row or garbage
+		}
+		rank = parsed
+	}
+
+	domain, err := normalize.Domain(fields[s.layout.domainCol], normalize.Options{StripWWW: s.opts.StripWWW})
+	if err != nil {
+		if s.opts.Invalid != nil {
+			s.opts.Invalid(s.line, err)
+		}
+		return Record{}, false
+	}
+
+	// Plain lists are ranked by their order
+	if s.layout.rankCol < 0 {
+		rank = int64(s.index) + 1
+	}
+
+	record := Record{
+		Domain: domain,
+		Rank:   rank,
+		Index:  s.index,
+		Line:   s.line,
+		Offset: s.offset,
+	}
+	s.index++
+	return record, true
+}
+
+func (s *lineSource) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func layoutFor(format, firstLine string) (layout, error) {
+	switch format {
+	case FormatTranco, FormatUmbrella:
+		return layout{delimited: true, rankCol: 0, domainCol: 1}, nil
+	case FormatMajestic:
+		return layout{delimited: true, rankCol: 0, domainCol: 2}, nil
+	case FormatText:
+		return layout{rankCol: -1, domainCol: 0}, nil
+	case FormatAuto, "":
+		return detectLayout(firstLine), nil
+	default:
+		return layout{}, fmt.Errorf("unknown input format %q", format)
+	}
+}
+
+// detectLayout guesses the layout from the first line of a list. Headers
+// name their columns; headerless lines are either rank,domain or a bare
+// domain.
+func detectLayout(firstLine string) layout {
+	fields, _ := splitCSV(strings.TrimSpace(firstLine))
+	if len(fields) < 2 {
+		return layout{rankCol: -1, domainCol: 0}
+	}
+
+	if _, err := strconv.ParseInt(unquote(fields[0]), 10, 64); err != nil {
+		// Header row, e.g. Majestic's "GlobalRank,TldRank,Domain,..." or
+		// DomCop's "Rank","Domain","Open Page Rank"
+		l := layout{delimited: true, rankCol: -1, domainCol: -1}
+		for i, field := range fields {
+			switch strings.ToLower(unquote(field)) {
+			case "domain", "domain name", "site", "host":
+				if l.domainCol < 0 {
+					l.domainCol = i
+				}
+			case "rank", "globalrank", "global rank":
+				if l.rankCol < 0 {
+					l.rankCol = i
+				}
+			}
+		}
+		if l.domainCol >= 0 {
+			return l
+		}
+		return layout{delimited: true, rankCol: -1, domainCol: 0}
+	}
+
+	return layout{delimited: true, rankCol: 0, domainCol: 1}
+}
+
+// splitCSV splits one line into its comma-separated fields. Quoted fields
+// may hold commas; lines without quotes skip the CSV reader.
+func splitCSV(line string) ([]string, bool) {
+	if !strings.Contains(line, `"`) {
+		return strings.Split(line, ","), true
+	}
+
+	r := csv.NewReader(strings.NewReader(line))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	fields, err := r.Read()
+	return fields, err == nil
+}
+
+func unquote(field string) string {
+	return strings.Trim(strings.TrimSpace(field), `"`)
+}
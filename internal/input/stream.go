@@ -0,0 +1,82 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Record is one domain read from the input list.
+type Record struct {
+	Domain string
+	Rank   int64 // Popularity rank from the list, or the position for unranked lists
+	Index  int   // Position among the records streamed from the start of the input
+	Line   int64 // Line number in the input file
+	Offset int64 // Byte offset just past this record, where a resume would start
+}
+
+type Options struct {
+	Format   string // One of the Format constants; FormatAuto detects it
+	StripWWW bool   // Fold www.example.com into example.com
+
+	// Called with the line number of each entry rejected as invalid
+	Invalid func(line int64, err error)
+
+	// Resume position, normally taken from a checkpoint
+	StartIndex  int
+	StartOffset int64
+	StartLine   int64
+
+	// Records buffered ahead of the consumer; the reader blocks once it is full
+	Buffer int
+}
+
+const defaultBuffer = 1000
+
+// Stream reads domains from a list without loading it into memory. The
+// record channel is closed when the input is exhausted, ctx is cancelled or
+// reading fails; the error channel then yields the failure, if any.
+func Stream(ctx context.Context, path string, opts Options) (<-chan Record, <-chan error) {
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+
+	records := make(chan Record, buffer)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(records)
+
+		if err := stream(ctx, path, opts, records); err != nil {
+			errs <- err
+		}
+	}()
+
+	return records, errs
+}
+
+func stream(ctx context.Context, path string, opts Options, records chan<- Record) error {
+	src, err := Open(path, opts)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	for {
+		record, err := src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		select {
+		case records <- record:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package mailsec
+
+import (
+	"github.com/recon-scanner/internal/database"
+)
+
+// Lowest score for each grade
+var gradeFloors = []struct {
+	grade string
+	score int
+}{
+	{"A", 85},
+	{"B", 70},
+	{"C", 50},
+	{"D", 30},
+}
+
+// Grade scores a domain's mail security out of 100 and maps the score to a
+// letter. DMARC weighs most, since it is what lets receivers act on SPF and
+// DKIM failures; MTA-STS, TLS-RPT and BIMI add smaller amounts.
+func Grade(ms *database.MailSecurity) (int, string) {
+	score := 0
+
+	if ms.SPFStatus == SPFValid {
+		switch ms.SPFAll {
+		case "-all":
+			score += 25
+		case "~all":
+			score += 20
+		case "?all", "":
+			score += 5
+		}
+	}
+
+	var dmarc int
+	switch ms.DMARCPolicy {
+	case "reject":
+		dmarc = 30
+	case "quarantine":
+		dmarc = 20
+	case "none":
+		dmarc = 5
+	}
+	// Enforcement applied to only some mail earns part of the credit
+	if ms.DMARCPolicy == "reject" || ms.DMARCPolicy == "quarantine" {
+		dmarc = 5 + (dmarc-5)*ms.DMARCPct/100
+	}
+	score += dmarc
+
+	if len(ms.DKIMSelectors) > 0 {
+		score += 20
+	}
+
+	switch {
+	case ms.MTASTSMode == "enforce":
+		score += 15
+	case ms.MTASTSMode == "testing", ms.MTASTSRecord != "" && ms.MTASTSMode == "":
+		score += 8
+	}
+
+	if ms.TLSRPTRecord != "" {
+		score += 5
+	}
+	if ms.BIMIRecord != "" {
+		score += 5
+	}
+
+	for _, floor := range gradeFloors {
+		if score >= floor.score {
+			return score, floor.grade
+		}
+	}
+	return score, "F"
+}
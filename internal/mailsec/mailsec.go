@@ -0,0 +1,278 @@
+// Package mailsec reads the email security policies a domain publishes in
+// DNS (SPF, DMARC, MTA-STS, TLS-RPT, BIMI and DKIM keys) and grades them.
+package mailsec
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/normalize"
+)
+
+// Bytes of an MTA-STS policy read, RFC 8461 section 3.3 allows 64KB
+const maxPolicySize = 64 * 1024
+
+// TXTLookup returns the TXT strings at name, each record's strings joined.
+// A name without TXT records is not an error.
+type TXTLookup func(ctx context.Context, name string) ([]string, error)
+
+// Checker gathers and grades the mail security of domains.
+type Checker struct {
+	lookupTXT TXTLookup
+	selectors []string
+	client    *http.Client // nil skips fetching MTA-STS policies
+}
+
+// NewChecker returns a checker trying the given DKIM selectors. A zero
+// policyTimeout leaves MTA-STS at its DNS record, without the HTTPS policy.
+func NewChecker(selectors []string, policyTimeout time.Duration, lookupTXT TXTLookup) *Checker {
+	c := &Checker{lookupTXT: lookupTXT, selectors: selectors}
+	if policyTimeout > 0 {
+		c.client = &http.Client{Timeout: policyTimeout}
+	}
+	return c
+}
+
+// Check looks up every policy of domain in parallel and grades the result.
+func (c *Checker) Check(ctx context.Context, domain string) *database.MailSecurity {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	ms := &database.MailSecurity{Domain: domain}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // Guards ms.DKIMSelectors
+	)
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+
+	run(func() {
+		spf := checkSPF(ctx, domain, c.lookupTXT)
+		ms.SPFRecord, ms.SPFStatus, ms.SPFAll = spf.record, spf.status, spf.all
+		ms.SPFLookups, ms.SPFIncludes, ms.SPFErrors = spf.lookups, spf.includes, spf.errors
+	})
+	run(func() { c.checkDMARC(ctx, ms) })
+	run(func() { c.checkMTASTS(ctx, ms) })
+	run(func() {
+		if record, tags := c.policy(ctx, "_smtp._tls."+domain, "TLSRPTv1"); record != "" {
+			ms.TLSRPTRecord = record
+			ms.TLSRPTReportURIs = splitURIs(tags["rua"])
+		}
+	})
+	run(func() {
+		if record, tags := c.policy(ctx, "default._bimi."+domain, "BIMI1"); record != "" {
+			ms.BIMIRecord, ms.BIMILogo, ms.BIMIAuthority = record, tags["l"], tags["a"]
+		}
+	})
+	for _, selector := range c.selectors {
+		selector := selector
+		run(func() {
+			if c.hasDKIMKey(ctx, selector+"._domainkey."+domain) {
+				mu.Lock()
+				ms.DKIMSelectors = append(ms.DKIMSelectors, selector)
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	// Keep the configured order rather than the order lookups finished in
+	found := make(map[string]bool, len(ms.DKIMSelectors))
+	for _, s := range ms.DKIMSelectors {
+		found[s] = true
+	}
+	ms.DKIMSelectors = ms.DKIMSelectors[:0]
+	for _, s := range c.selectors {
+		if found[s] {
+			ms.DKIMSelectors = append(ms.DKIMSelectors, s)
+		}
+	}
+
+	ms.Score, ms.Grade = Grade(ms)
+	ms.CheckedAt = time.Now()
+	return ms
+}
+
+// checkDMARC reads _dmarc of the domain, falling back to the organizational
+// domain whose sp= then applies (RFC 7489 section 6.6.3).
+func (c *Checker) checkDMARC(ctx context.Context, ms *database.MailSecurity) {
+	at := ms.Domain
+	record, tags := c.policy(ctx, "_dmarc."+at, "DMARC1")
+	if record == "" {
+		apex := normalize.Apex(ms.Domain)
+		if apex == ms.Domain {
+			return
+		}
+		at = apex
+		if record, tags = c.policy(ctx, "_dmarc."+at, "DMARC1"); record == "" {
+			return
+		}
+	}
+
+	ms.DMARCRecord, ms.DMARCDomain = record, at
+	ms.DMARCPolicy = dmarcPolicy(tags["p"])
+	ms.DMARCSubdomainPolicy = dmarcPolicy(tags["sp"])
+	ms.DMARCReportURIs = splitURIs(tags["rua"])
+
+	// Inherited policies apply as the subdomain policy
+	if at != ms.Domain && ms.DMARCSubdomainPolicy != "" {
+		ms.DMARCPolicy = ms.DMARCSubdomainPolicy
+	}
+	// A record with an invalid p= but reporting addresses means p=none
+	if ms.DMARCPolicy == "" && len(ms.DMARCReportURIs) > 0 {
+		ms.DMARCPolicy = "none"
+	}
+
+	ms.DMARCPct = 100
+	if pct, err := strconv.Atoi(tags["pct"]); err == nil && pct >= 0 && pct <= 100 {
+		ms.DMARCPct = pct
+	}
+}
+
+func dmarcPolicy(p string) string {
+	switch p = strings.ToLower(p); p {
+	case "none", "quarantine", "reject":
+		return p
+	}
+	return ""
+}
+
+// checkMTASTS reads the _mta-sts record and, with an HTTP client, the policy
+// it announces.
+func (c *Checker) checkMTASTS(ctx context.Context, ms *database.MailSecurity) {
+	record, _ := c.policy(ctx, "_mta-sts."+ms.Domain, "STSv1")
+	if record == "" {
+		return
+	}
+	ms.MTASTSRecord = record
+	if c.client == nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://mta-sts."+ms.Domain+"/.well-known/mta-sts.txt", nil)
+	if err != nil {
+		return
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	// Lines of "key: value", RFC 8461 section 3.2
+	var (
+		version string
+		mode    string
+		mx      []string
+	)
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxPolicySize))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "version":
+			version = value
+		case "mode":
+			mode = strings.ToLower(value)
+		case "mx":
+			mx = append(mx, strings.ToLower(value))
+		}
+	}
+	if version == "STSv1" {
+		ms.MTASTSMode, ms.MTASTSMX = mode, mx
+	}
+}
+
+// hasDKIMKey reports whether name publishes a DKIM key. An empty p= is a
+// revoked key and does not count.
+func (c *Checker) hasDKIMKey(ctx context.Context, name string) bool {
+	texts, err := c.lookupTXT(ctx, name)
+	if err != nil {
+		return false
+	}
+	for _, txt := range texts {
+		tags := parseTags(txt)
+		if v, ok := tags["v"]; ok && v != "DKIM1" {
+			continue
+		}
+		if p, ok := tags["p"]; ok && p != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// policy returns the one record at name whose v= tag is version, and its
+// tags. None, or more than one, returns an empty record.
+func (c *Checker) policy(ctx context.Context, name, version string) (string, map[string]string) {
+	texts, err := c.lookupTXT(ctx, name)
+	if err != nil {
+		return "", nil
+	}
+
+	var (
+		record string
+		tags   map[string]string
+	)
+	for _, txt := range texts {
+		t := parseTags(txt)
+		if !strings.EqualFold(t["v"], version) || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(txt)), "v=") {
+			continue
+		}
+		if record != "" {
+			return "", nil
+		}
+		record, tags = txt, t
+	}
+	return record, tags
+}
+
+// parseTags splits a tag=value; list as used by DKIM, DMARC, MTA-STS,
+// TLS-RPT and BIMI. Tag names are lower-cased; whitespace in DKIM key data
+// is removed.
+func parseTags(txt string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(txt, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key == "p" {
+			value = strings.Join(strings.Fields(value), "")
+		}
+		if _, dup := tags[key]; !dup {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// splitURIs splits a comma-separated rua= list.
+func splitURIs(list string) []string {
+	var uris []string
+	for _, uri := range strings.Split(list, ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
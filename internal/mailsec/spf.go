@@ -0,0 +1,240 @@
+package mailsec
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RFC 7208 section 4.6.4 limits
+const (
+	maxSPFLookups     = 10
+	maxSPFVoidLookups = 2
+)
+
+// SPF outcomes
+const (
+	SPFNone      = "none"
+	SPFValid     = "valid"
+	SPFPermError = "permerror"
+	SPFTempError = "temperror"
+)
+
+// spfResult is an SPF record followed through its includes and redirect.
+type spfResult struct {
+	record   string
+	status   string
+	all      string // Qualifier and mechanism, e.g. -all; empty when there is none
+	lookups  int
+	includes []string
+	errors   []string
+}
+
+// spfWalk expands one domain's SPF policy, counting the terms that cost a
+// DNS lookup across every record it reaches.
+type spfWalk struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	lookups   int
+	voids     int
+	includes  []string
+	errors    []string
+	temporary bool
+	path      map[string]bool // Domains being expanded, to catch loops
+}
+
+func checkSPF(ctx context.Context, domain string, lookupTXT func(ctx context.Context, name string) ([]string, error)) spfResult {
+	w := &spfWalk{lookupTXT: lookupTXT, path: map[string]bool{domain: true}}
+
+	record, found := w.fetch(ctx, domain)
+	if !found {
+		if w.temporary {
+			return spfResult{status: SPFTempError, errors: w.errors}
+		}
+		if len(w.errors) > 0 {
+			return spfResult{status: SPFPermError, errors: w.errors}
+		}
+		return spfResult{status: SPFNone}
+	}
+
+	all := w.walk(ctx, domain, record)
+	res := spfResult{
+		record:   record,
+		status:   SPFValid,
+		all:      all,
+		lookups:  w.lookups,
+		includes: w.includes,
+		errors:   w.errors,
+	}
+	switch {
+	case w.temporary:
+		res.status = SPFTempError
+	case len(w.errors) > 0:
+		res.status = SPFPermError
+	}
+	return res
+}
+
+// fetch returns the single SPF record of domain. More than one is an error,
+// as is a lookup that fails.
+func (w *spfWalk) fetch(ctx context.Context, domain string) (string, bool) {
+	texts, err := w.lookupTXT(ctx, domain)
+	if err != nil {
+		w.temporary = true
+		w.errors = append(w.errors, fmt.Sprintf("lookup of %s failed: %v", domain, err))
+		return "", false
+	}
+
+	var records []string
+	for _, txt := range texts {
+		if isSPF(txt) {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", false
+	case 1:
+		return records[0], true
+	}
+	w.errors = append(w.errors, fmt.Sprintf("%s has %d SPF records", domain, len(records)))
+	return "", false
+}
+
+func isSPF(txt string) bool {
+	lower := strings.ToLower(strings.TrimSpace(txt))
+	return lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 ")
+}
+
+// walk checks the terms of record, published at domain, and follows its
+// includes and redirect. It returns the all mechanism that ends the policy.
+func (w *spfWalk) walk(ctx context.Context, domain, record string) string {
+	var (
+		all      string
+		redirect string
+	)
+
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+
+		// Modifiers are name=value; only redirect changes the policy
+		if eq := strings.IndexByte(lower, '='); eq > 0 && !strings.ContainsAny(lower[:eq], ":/") {
+			if lower[:eq] == "redirect" {
+				redirect = term[eq+1:]
+			}
+			continue
+		}
+
+		qualifier := "+"
+		if strings.ContainsRune("+-~?", rune(lower[0])) {
+			qualifier, lower, term = lower[:1], lower[1:], term[1:]
+		}
+		name, arg := lower, ""
+		if i := strings.IndexAny(lower, ":/"); i >= 0 {
+			name, arg = lower[:i], term[i:]
+		}
+
+		switch name {
+		case "all":
+			all = qualifier + "all"
+		case "ip4", "ip6":
+			if !validNetwork(strings.TrimPrefix(arg, ":"), name == "ip6") {
+				w.errors = append(w.errors, fmt.Sprintf("invalid %s in %s", term, domain))
+			}
+		case "a", "mx", "ptr", "exists":
+			w.count(domain, term)
+		case "include":
+			w.count(domain, term)
+			w.include(ctx, strings.TrimPrefix(arg, ":"))
+		default:
+			w.errors = append(w.errors, fmt.Sprintf("unknown mechanism %q in %s", term, domain))
+		}
+	}
+
+	// A redirect only applies when the record has no all of its own
+	if redirect != "" && all == "" {
+		w.count(domain, "redirect="+redirect)
+		target := strings.ToLower(strings.TrimSuffix(redirect, "."))
+		if w.expandable(target) {
+			failures := len(w.errors)
+			if record, found := w.fetch(ctx, target); found {
+				w.includes = append(w.includes, target)
+				w.path[target] = true
+				defer delete(w.path, target)
+				return w.walk(ctx, target, record)
+			}
+			if len(w.errors) == failures {
+				w.void(target)
+				w.errors = append(w.errors, fmt.Sprintf("redirect target %s has no SPF record", target))
+			}
+		}
+	}
+	return all
+}
+
+// include follows an include mechanism. Its all does not end the policy.
+func (w *spfWalk) include(ctx context.Context, target string) {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	if !w.expandable(target) {
+		return
+	}
+
+	failures := len(w.errors)
+	record, found := w.fetch(ctx, target)
+	if !found {
+		// Lookup failures and duplicate records are reported by fetch
+		if len(w.errors) == failures {
+			w.void(target)
+			w.errors = append(w.errors, fmt.Sprintf("included %s has no SPF record", target))
+		}
+		return
+	}
+	w.includes = append(w.includes, target)
+	w.path[target] = true
+	w.walk(ctx, target, record)
+	delete(w.path, target)
+}
+
+// expandable reports whether target can be fetched: not a macro, not one of
+// the records that led to it, and within the lookup limit.
+func (w *spfWalk) expandable(target string) bool {
+	switch {
+	case target == "" || strings.Contains(target, "%{"):
+		return false
+	case w.path[target]:
+		w.errors = append(w.errors, fmt.Sprintf("include loop back to %s", target))
+		return false
+	}
+	return w.lookups <= maxSPFLookups
+}
+
+func (w *spfWalk) count(domain, term string) {
+	w.lookups++
+	if w.lookups == maxSPFLookups+1 {
+		w.errors = append(w.errors, fmt.Sprintf("more than %d DNS lookups, exceeded at %s in %s", maxSPFLookups, term, domain))
+	}
+}
+
+func (w *spfWalk) void(target string) {
+	w.voids++
+	if w.voids == maxSPFVoidLookups+1 {
+		w.errors = append(w.errors, fmt.Sprintf("more than %d void lookups, exceeded at %s", maxSPFVoidLookups, target))
+	}
+}
+
+// validNetwork checks an ip4 or ip6 argument: an address with an optional
+// prefix length.
+func validNetwork(arg string, v6 bool) bool {
+	addr := arg
+	if i := strings.IndexByte(arg, '/'); i >= 0 {
+		if _, _, err := net.ParseCIDR(arg); err != nil {
+			return false
+		}
+		addr = arg[:i]
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	return (ip.To4() == nil) == v6
+}
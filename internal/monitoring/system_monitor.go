@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,13 @@ import (
 	"github.com/recon-scanner/internal/config"
 )
 
+// Memory use, in percent, above which GetOptimalWorkerCount halves the pool
+// and, further up, shrinks it to MinWorkers
+const (
+	MemoryThrottlePercent = 75.0
+	MemoryCriticalPercent = 90.0
+)
+
 type SystemMonitor struct {
 	config       *config.HighPerformanceConfig
 	metrics      *SystemMetrics
@@ -32,6 +40,11 @@ type SystemMetrics struct {
 	ProcessedItems  int64
 	ErrorRate       float64
 	NetworkErrors   int64
+	QueueDepths     map[int]int // Queued tasks per priority
+	DNSCacheHits    int64
+	DNSCacheMisses  int64
+	DNSCacheEntries int
+	DNSCacheBytes   int64
 	LastUpdated     time.Time
 }
 
@@ -148,8 +161,28 @@ func (sm *SystemMonitor) performHealthCheck() {
 	metrics := *sm.metrics
 	sm.mu.RUnlock()
 	
-	log.Printf("System Health Check - CPU: %.1f°C, Memory: %.1f%%, Workers: %d, Processed: %d, Errors: %.2f%%",
-		metrics.CPUTemp, metrics.MemoryPercent, metrics.ActiveWorkers, metrics.ProcessedItems, metrics.ErrorRate)
+	log.Printf("System Health Check - CPU: %.1f°C, Memory: %.1f%%, Workers: %d, Processed: %d, Errors: %.2f%%, Queue: %s",
+		metrics.CPUTemp, metrics.MemoryPercent, metrics.ActiveWorkers, metrics.ProcessedItems, metrics.ErrorRate,
+		FormatQueueDepths(metrics.QueueDepths))
+}
+
+// FormatQueueDepths renders per-priority depths highest priority first, e.g. "p10=3 p1=4200".
+func FormatQueueDepths(depths map[int]int) string {
+	if len(depths) == 0 {
+		return "empty"
+	}
+
+	priorities := make([]int, 0, len(depths))
+	for priority := range depths {
+		priorities = append(priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	parts := make([]string, len(priorities))
+	for i, priority := range priorities {
+		parts[i] = fmt.Sprintf("p%d=%d", priority, depths[priority])
+	}
+	return strings.Join(parts, " ")
 }
 
 func (sm *SystemMonitor) getCPUTemperature() float64 {
@@ -212,11 +245,11 @@ func (sm *SystemMonitor) GetOptimalWorkerCount() int {
 	memory := sm.metrics.MemoryPercent
 	sm.mu.RUnlock()
 	
-	if temp > sm.config.MaxCPUTemp || memory > 90.0 {
+	if temp > sm.config.MaxCPUTemp || memory > MemoryCriticalPercent {
 		return sm.config.MinWorkers
 	}
 	
-	if temp > sm.config.ThrottleTemp || memory > 75.0 {
+	if temp > sm.config.ThrottleTemp || memory > MemoryThrottlePercent {
 		return sm.config.MaxWorkers / 2
 	}
 	
@@ -230,4 +263,30 @@ func (sm *SystemMonitor) UpdateStats(workers int, processed int64, errorRate flo
 	sm.metrics.ErrorRate = errorRate
 	sm.metrics.LastUpdated = time.Now()
 	sm.mu.Unlock()
-}
\ No newline at end of file
+}
+
+// UpdateQueueDepths replaces the per-priority queue depths. The map must not
+// be modified afterwards since GetMetrics hands it out as-is.
+func (sm *SystemMonitor) UpdateQueueDepths(depths map[int]int) {
+	sm.mu.Lock()
+	sm.metrics.QueueDepths = depths
+	sm.mu.Unlock()
+}
+
+func (sm *SystemMonitor) UpdateDNSCache(hits, misses int64, entries int, bytes int64) {
+	sm.mu.Lock()
+	sm.metrics.DNSCacheHits = hits
+	sm.metrics.DNSCacheMisses = misses
+	sm.metrics.DNSCacheEntries = entries
+	sm.metrics.DNSCacheBytes = bytes
+	sm.mu.Unlock()
+}
+
+// DNSCacheHitRate is the share of lookups answered from the cache, in percent.
+func (m SystemMetrics) DNSCacheHitRate() float64 {
+	total := m.DNSCacheHits + m.DNSCacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.DNSCacheHits) / float64(total) * 100
+}
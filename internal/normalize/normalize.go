@@ -0,0 +1,155 @@
+// Package normalize turns the loosely formatted entries of domain lists into
+// canonical lowercase A-label names and finds their registrable domain.
+package normalize
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// RFC 1035 limits, measured on the A-label form
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+// Maps Unicode input the way browsers do before converting it to A-labels.
+// Underscores are allowed because lists contain service names like _dmarc.
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+	idna.Transitional(false),
+)
+
+type Options struct {
+	StripWWW bool // Fold www.example.com into example.com
+}
+
+// InvalidError explains why an input entry is not a usable domain name.
+type InvalidError struct {
+	Input  string
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid domain %q: %s", e.Input, e.Reason)
+}
+
+func invalid(input, format string, args ...interface{}) error {
+	return &InvalidError{Input: input, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Domain normalizes a list entry, which may be a bare name or a URL, to a
+// lowercase A-label name without a trailing dot. Entries that are not valid
+// host names return an *InvalidError.
+func Domain(raw string, opts Options) (string, error) {
+	host := strings.TrimSpace(strings.Trim(strings.TrimSpace(raw), `"'`))
+	if host == "" {
+		return "", invalid(raw, "empty")
+	}
+
+	host = stripURL(host)
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", invalid(raw, "no host name")
+	}
+
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return "", invalid(raw, "IP address, not a domain name")
+	}
+
+	name, err := profile.ToASCII(host)
+	if err != nil {
+		return "", invalid(raw, "%v", err)
+	}
+	name = strings.ToLower(name)
+
+	if opts.StripWWW && strings.HasPrefix(name, "www.") && strings.Count(name, ".") > 1 {
+		name = strings.TrimPrefix(name, "www.")
+	}
+
+	if err := validate(name); err != nil {
+		return "", invalid(raw, "%s", err)
+	}
+	return name, nil
+}
+
+// stripURL removes the scheme, credentials, port, path, query and fragment
+// from entries that were listed as URLs.
+func stripURL(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	} else {
+		s = strings.TrimPrefix(s, "//")
+	}
+
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	// Bracketed IPv6 literals carry colons of their own
+	if strings.HasPrefix(s, "[") {
+		if i := strings.Index(s, "]"); i >= 0 {
+			return s[:i+1]
+		}
+		return s
+	}
+	if i := strings.LastIndex(s, ":"); i >= 0 && strings.Count(s, ":") == 1 {
+		s = s[:i]
+	}
+	return s
+}
+
+func validate(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name is %d bytes, longer than %d", len(name), maxNameLength)
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("single label, no TLD")
+	}
+
+	for _, label := range labels {
+		if label == "" {
+			return fmt.Errorf("empty label")
+		}
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("label %q is longer than %d bytes", label, maxLabelLength)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("label %q contains %q", label, c)
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	if strings.Trim(tld, "0123456789") == "" {
+		return fmt.Errorf("numeric TLD %q", tld)
+	}
+	return nil
+}
+
+// Apex returns the registrable domain of a normalized name using the
+// embedded Public Suffix List, e.g. example.co.uk for www.example.co.uk.
+// A name that is itself a public suffix has no apex and is returned as is.
+func Apex(name string) string {
+	apex, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return name
+	}
+	return apex
+}
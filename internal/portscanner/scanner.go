@@ -2,9 +2,11 @@ package portscanner
 
 import (
 	"bufio"
-	"fmt"
+	"errors"
 	"net"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/recon-scanner/internal/config"
@@ -23,17 +25,27 @@ func (s *Scanner) ScanPort(ip string, port int) (*database.PortResult, error) {
 	result := &database.PortResult{
 		IP:          ip,
 		Port:        port,
+		Protocol:    database.ProtocolTCP,
+		State:       database.PortStateClosed,
 		IsOpen:      false,
 		ProcessedAt: time.Now(),
 	}
 
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), s.config.Timeout)
+	timeout := s.config.GetCurrentProfile().Timeout
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), timeout)
+	result.RTT = time.Since(start)
 	if err != nil {
+		// A refused connection means closed; silence means something dropped the SYN
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			result.State = database.PortStateFiltered
+		}
 		return result, nil // Port is closed, not an error
 	}
 	defer conn.Close()
 
 	result.IsOpen = true
+	result.State = database.PortStateOpen
 
 	// Try to grab banner
 	banner, service := s.grabBanner(conn, port)
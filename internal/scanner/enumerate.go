@@ -0,0 +1,197 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/dns"
+	"github.com/recon-scanner/internal/enumerate"
+)
+
+// Names checked against the database per query
+const processedChunk = 500
+
+// enumerateSubdomains guesses names under the apex of every resolved input
+// domain and stores those that exist, so the IP and port phases pick them
+// up. Parents are recorded as they finish, which is what a rerun resumes from.
+func (s *Scanner) enumerateSubdomains(ctx context.Context) error {
+	words, err := enumerate.LoadWordlist(s.config.SubdomainWordlist)
+	if err != nil {
+		return fmt.Errorf("failed to load wordlist: %w", err)
+	}
+
+	parents, err := s.db.GetEnumerationParents(0)
+	if err != nil {
+		return fmt.Errorf("failed to get domains to enumerate: %w", err)
+	}
+	fmt.Printf("Enumerating subdomains of %d domains with %d words\n", len(parents), len(words))
+
+	s.scheduler.WaitForOptimalTime("subdomain enumeration")
+
+	for i, parent := range parents {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		e := s.enumerateParent(parent, words)
+		if e == nil {
+			log.Printf("Skipping enumeration of %s: wildcard check failed, it is retried next run", parent)
+			continue
+		}
+		// Not recording it leaves an unreachable parent for the next run
+		if e.Candidates > 0 && e.Errors == e.Candidates {
+			log.Printf("Every probe under %s failed, it is retried next run", parent)
+			continue
+		}
+		if err := s.db.SaveEnumeration(e); err != nil {
+			log.Printf("Failed to save enumeration of %s: %v", parent, err)
+		}
+
+		mode := s.config.GetModeString()
+		fmt.Printf("%s Enumerated %s (%d/%d): %d found, %d wildcard, %d tried\n",
+			mode, parent, i+1, len(parents), e.Discovered, e.Wildcard, e.Candidates)
+	}
+	return nil
+}
+
+// enumerateParent tries the wordlist under parent, then permutations of
+// what it found. It returns nil without trying anything when the wildcard
+// check fails, since guesses could not be told apart from wildcard answers.
+func (s *Scanner) enumerateParent(parent string, words []string) *database.Enumeration {
+	wz := s.dns.Wildcard(parent)
+	if wz == nil {
+		return nil
+	}
+
+	e := &database.Enumeration{Parent: parent}
+	tried := map[string]bool{parent: true}
+
+	found := s.tryCandidates(enumerate.Wordlist(parent, words), database.SourceWordlist, wz, tried, e)
+
+	if s.config.SubdomainPermutations {
+		var permutations []enumerate.Candidate
+		for _, name := range found {
+			permutations = append(permutations, enumerate.Permutations(name, parent)...)
+		}
+		s.tryCandidates(permutations, database.SourcePermutation, wz, tried, e)
+	}
+
+	e.FinishedAt = time.Now()
+	return e
+}
+
+// tryCandidates probes the candidates not tried or stored yet, within the
+// per-parent limit, and resolves and stores those that exist and are not
+// just the zone's wildcard answering. It returns the names stored.
+func (s *Scanner) tryCandidates(candidates []enumerate.Candidate, source string, wz *database.WildcardZone, tried map[string]bool, e *database.Enumeration) []string {
+	var fresh []enumerate.Candidate
+	for _, c := range candidates {
+		if tried[c.Name] {
+			continue
+		}
+		if s.config.MaxSubdomainCandidates > 0 && e.Candidates+len(fresh) >= s.config.MaxSubdomainCandidates {
+			break
+		}
+		tried[c.Name] = true
+		fresh = append(fresh, c)
+	}
+
+	fresh, err := s.filterStored(fresh)
+	if err != nil {
+		log.Printf("Failed to check stored subdomains: %v", err)
+		return nil
+	}
+	e.Candidates += len(fresh)
+
+	profile := s.config.GetCurrentProfile()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		found []string
+	)
+	semaphore := make(chan struct{}, profile.WorkerCount)
+
+	for _, candidate := range fresh {
+		wg.Add(1)
+		go func(c enumerate.Candidate) {
+			defer wg.Done()
+			semaphore <- struct{}{} // Acquire
+			defer func() { <-semaphore }() // Release
+
+			defer time.Sleep(s.scheduler.GetAdaptiveDelay(profile.RequestDelay))
+
+			probe, err := s.dns.Probe(c.Name)
+			if probe == nil {
+				if dns.IsRetryable(err) {
+					mu.Lock()
+					e.Errors++
+					mu.Unlock()
+				}
+				return
+			}
+			if dns.MatchesWildcard(probe, wz) {
+				mu.Lock()
+				e.Wildcard++
+				mu.Unlock()
+				return
+			}
+
+			result, err := s.dns.ResolveDomain(c.Name)
+			if dns.IsRetryable(err) {
+				log.Printf("Failed to resolve discovered %s: %v", c.Name, err)
+				mu.Lock()
+				e.Errors++
+				mu.Unlock()
+				return
+			}
+			result.Source = source
+			result.DiscoveredFrom = c.From
+
+			if err := s.db.SaveDomain(result); err != nil {
+				log.Printf("Failed to save domain %s: %v", c.Name, err)
+				return
+			}
+
+			mu.Lock()
+			e.Discovered++
+			found = append(found, c.Name)
+			mu.Unlock()
+		}(candidate)
+	}
+
+	wg.Wait()
+	return found
+}
+
+// filterStored drops candidates that already have results, such as input
+// domains or names found by an earlier run.
+func (s *Scanner) filterStored(candidates []enumerate.Candidate) ([]enumerate.Candidate, error) {
+	var remaining []enumerate.Candidate
+	for start := 0; start < len(candidates); start += processedChunk {
+		end := start + processedChunk
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+
+		names := make([]string, 0, end-start)
+		for _, c := range candidates[start:end] {
+			names = append(names, c.Name)
+		}
+		stored, err := s.db.GetProcessedAmong(names)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range candidates[start:end] {
+			if !stored[c.Name] {
+				remaining = append(remaining, c)
+			}
+		}
+	}
+	return remaining, nil
+}
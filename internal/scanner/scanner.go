@@ -1,24 +1,40 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/recon-scanner/internal/checkpoint"
 	"github.com/recon-scanner/internal/config"
 	"github.com/recon-scanner/internal/database"
 	"github.com/recon-scanner/internal/dns"
+	"github.com/recon-scanner/internal/input"
 	"github.com/recon-scanner/internal/portscanner"
 	"github.com/recon-scanner/internal/scheduler"
 )
 
+const phaseDNS = "dns_resolution"
+
 type Scanner struct {
 	config      *config.Config
 	db          *database.Database
 	dns         *dns.Resolver
 	portScanner *portscanner.Scanner
 	scheduler   *scheduler.Scheduler
+	checkpoint  *checkpoint.Checkpointer
+}
+
+// pendingDomain keeps a domain's position in the input so checkpoints
+// refer to the input file rather than the filtered work list.
+type pendingDomain struct {
+	index int
+	name  string
+	rank  int64
+	after checkpoint.Position // Resume position once this domain is done
 }
 
 func New(cfg *config.Config, db *database.Database) *Scanner {
@@ -31,7 +47,18 @@ func New(cfg *config.Config, db *database.Database) *Scanner {
 	}
 }
 
-func (s *Scanner) Run(domains []string) error {
+// Run streams domains from the configured input list through every phase,
+// resuming from the last checkpoint. Cancelling ctx stops reading input and
+// starting new work; Run then returns ctx.Err() once in-flight domains are
+// saved and the checkpoint is flushed.
+func (s *Scanner) Run(ctx context.Context) error {
+	cp, err := checkpoint.New(s.db, s.config.CSVFile, s.config.CheckpointInterval)
+	if err != nil {
+		return err
+	}
+	s.checkpoint = cp
+	defer s.checkpoint.Flush()
+
 	// Start the scheduler
 	s.scheduler.Start()
 	defer s.scheduler.Stop()
@@ -40,24 +67,40 @@ func (s *Scanner) Run(domains []string) error {
 	s.logCurrentStatus()
 	
 	fmt.Println("📋 Phase 1: DNS Resolution")
-	if err := s.resolveDNS(domains); err != nil {
+	if err := s.resolveDNS(ctx); err != nil {
 		return fmt.Errorf("DNS resolution failed: %w", err)
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if s.config.EnumerateSubdomains {
+		fmt.Println("🌿 Phase 2: Subdomain enumeration")
+		if err := s.enumerateSubdomains(ctx); err != nil {
+			return fmt.Errorf("subdomain enumeration failed: %w", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
 
-	fmt.Println("🔍 Phase 2: Extracting unique IPs and reverse lookup")
-	uniqueIPs, err := s.extractAndProcessIPs()
+	fmt.Println("🔍 Phase 3: Extracting unique IPs and reverse lookup")
+	uniqueIPs, err := s.extractAndProcessIPs(ctx)
 	if err != nil {
 		return fmt.Errorf("IP extraction failed: %w", err)
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 
 	fmt.Printf("Found %d unique IPs\n", len(uniqueIPs))
 
-	fmt.Println("🔌 Phase 3: Port Scanning")
-	if err := s.scanPorts(uniqueIPs); err != nil {
+	fmt.Println("🔌 Phase 4: Port Scanning")
+	if err := s.scanPorts(ctx, uniqueIPs); err != nil {
 		return fmt.Errorf("port scanning failed: %w", err)
 	}
 
-	return nil
+	return ctx.Err()
 }
 
 func (s *Scanner) logCurrentStatus() {
@@ -76,77 +119,76 @@ func (s *Scanner) logCurrentStatus() {
 	fmt.Printf("Time until mode change: %v\n\n", timeUntilChange)
 }
 
-func (s *Scanner) resolveDNS(domains []string) error {
+func (s *Scanner) resolveDNS(ctx context.Context) error {
 	// Wait for optimal time if intensive operation
 	s.scheduler.WaitForOptimalTime("DNS resolution")
 	
 	// Check for existing progress
-	progress, err := s.db.GetLastProgress("dns_resolution")
+	progress, err := s.checkpoint.Resume(phaseDNS)
+	if errors.Is(err, checkpoint.ErrInputChanged) {
+		return fmt.Errorf("refusing to resume: %w", err)
+	}
 	if err != nil {
 		log.Printf("Error checking DNS progress: %v", err)
 	}
 
-	startIndex := 0
+	start := checkpoint.PositionOf(progress)
 	if progress != nil {
-		startIndex = progress.ItemIndex
-		fmt.Printf("Resuming DNS resolution from index %d\n", startIndex)
-	}
-
-	// Get already processed domains
-	processed, err := s.db.GetProcessedDomains()
-	if err != nil {
-		return fmt.Errorf("failed to get processed domains: %w", err)
-	}
-
-	// Filter out already processed domains
-	var remainingDomains []string
-	for i := startIndex; i < len(domains); i++ {
-		if !processed[domains[i]] {
-			remainingDomains = append(remainingDomains, domains[i])
-		}
+		fmt.Printf("Resuming DNS resolution from line %d (item %d, run %s)\n",
+			start.Line, start.ItemIndex, progress.RunID)
 	}
 
-	fmt.Printf("Processing %d remaining domains\n", len(remainingDomains))
-
-	// Process in batches with dynamic sizing based on current mode
 	profile := s.config.GetCurrentProfile()
-	batchSize := profile.BatchSize
-	totalBatches := (len(remainingDomains) + batchSize - 1) / batchSize
+	records, errs := input.Stream(ctx, s.config.CSVFile, input.Options{
+		Format:      s.config.InputFormat,
+		StripWWW:    s.config.StripWWW,
+		Invalid:     logInvalid,
+		StartIndex:  start.ItemIndex,
+		StartOffset: start.Offset,
+		StartLine:   start.Line,
+		Buffer:      profile.BatchSize,
+	})
+
+	watermark := checkpoint.NewWatermark(start)
+	batchIndex := start.BatchIndex
+	if progress != nil {
+		batchIndex++
+	}
 
-	for batchIndex := 0; batchIndex < totalBatches; batchIndex++ {
+	for {
 		// Check if mode changed and update batch processing accordingly
 		currentProfile := s.config.GetCurrentProfile()
 		if currentProfile.BatchSize != profile.BatchSize {
 			profile = currentProfile
 			fmt.Printf("🔄 Performance mode changed, adapting batch processing\n")
 		}
-		
-		start := batchIndex * batchSize
-		end := start + batchSize
-		if end > len(remainingDomains) {
-			end = len(remainingDomains)
+
+		batch := readBatch(records, profile.BatchSize, batchIndex)
+		if len(batch) == 0 {
+			break
+		}
+
+		// Filter out already processed domains
+		remaining, err := s.filterProcessed(batch, watermark)
+		if err != nil {
+			return fmt.Errorf("failed to get processed domains: %w", err)
 		}
 
-		batch := remainingDomains[start:end]
 		mode := s.config.GetModeString()
-		fmt.Printf("%s Processing DNS batch %d/%d (%d domains)\n", 
-			mode, batchIndex+1, totalBatches, len(batch))
+		fmt.Printf("%s Processing DNS batch %d (%d domains, %d already done)\n", 
+			mode, batchIndex+1, len(remaining), len(batch)-len(remaining))
 
-		if err := s.processDNSBatch(batch); err != nil {
+		if err := s.processDNSBatch(remaining, batchIndex, watermark); err != nil {
 			log.Printf("Error processing DNS batch %d: %v", batchIndex, err)
-			continue
 		}
 
-		// Save progress
-		progress := &database.Progress{
-			Phase:       "dns_resolution",
-			BatchIndex:  batchIndex,
-			ItemIndex:   start + len(batch),
-			CompletedAt: time.Now(),
+		// Save progress at every batch boundary
+		if err := s.checkpoint.Save(phaseDNS, watermark.Mark()); err != nil {
+			log.Printf("Failed to save DNS checkpoint: %v", err)
 		}
-		s.db.SaveProgress(progress)
 
-		fmt.Printf("Completed DNS batch %d/%d\n", batchIndex+1, totalBatches)
+		fmt.Printf("Completed DNS batch %d\n", batchIndex+1)
+		batchIndex++
 		
 		// Add inter-batch delay during conservation mode
 		if s.scheduler.ShouldThrottle() {
@@ -154,10 +196,63 @@ func (s *Scanner) resolveDNS(domains []string) error {
 		}
 	}
 
+	if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
 	return nil
 }
 
-func (s *Scanner) processDNSBatch(domains []string) error {
+func logInvalid(line int64, err error) {
+	log.Printf("Skipping input line %d: %v", line, err)
+}
+
+// readBatch blocks until size records have arrived or the input is exhausted.
+func readBatch(records <-chan input.Record, size, batchIndex int) []pendingDomain {
+	var batch []pendingDomain
+	for record := range records {
+		batch = append(batch, pendingDomain{
+			index: record.Index,
+			name:  record.Domain,
+			rank:  record.Rank,
+			after: checkpoint.Position{
+				BatchIndex: batchIndex,
+				ItemIndex:  record.Index + 1,
+				Offset:     record.Offset,
+				Line:       record.Line,
+			},
+		})
+		if len(batch) >= size {
+			break
+		}
+	}
+	return batch
+}
+
+// filterProcessed drops domains that already have results, marking them done
+// in the watermark so checkpoints can move past them.
+func (s *Scanner) filterProcessed(batch []pendingDomain, watermark *checkpoint.Watermark) ([]pendingDomain, error) {
+	names := make([]string, len(batch))
+	for i, d := range batch {
+		names[i] = d.name
+	}
+
+	processed, err := s.db.GetProcessedAmong(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining []pendingDomain
+	for _, d := range batch {
+		if processed[d.name] {
+			watermark.Done(d.index, d.after)
+			continue
+		}
+		remaining = append(remaining, d)
+	}
+	return remaining, nil
+}
+
+func (s *Scanner) processDNSBatch(domains []pendingDomain, batchIndex int, watermark *checkpoint.Watermark) error {
 	profile := s.config.GetCurrentProfile()
 	
 	var wg sync.WaitGroup
@@ -165,19 +260,30 @@ func (s *Scanner) processDNSBatch(domains []string) error {
 	
 	for _, domain := range domains {
 		wg.Add(1)
-		go func(d string) {
+		go func(d pendingDomain) {
 			defer wg.Done()
 			semaphore <- struct{}{} // Acquire
 			defer func() { <-semaphore }() // Release
 
-			result, err := s.dns.ResolveDomain(d)
-			if err != nil {
-				log.Printf("Failed to resolve %s: %v", d, err)
+			// Lookup failures are stored per type; transient address failures
+			// hold the checkpoint so the next run resolves the domain again
+			result, err := s.dns.ResolveDomain(d.name)
+			if dns.IsRetryable(err) {
+				log.Printf("Failed to resolve %s: %v", d.name, err)
+				watermark.Hold(d.index)
 				return
 			}
+			result.Rank = d.rank
 
 			if err := s.db.SaveDomain(result); err != nil {
-				log.Printf("Failed to save domain %s: %v", d, err)
+				log.Printf("Failed to save domain %s: %v", d.name, err)
+				watermark.Hold(d.index)
+				return
+			}
+
+			// Checkpoint on CheckpointInterval, not only at batch boundaries
+			if err := s.checkpoint.Update(phaseDNS, watermark.Done(d.index, d.after)); err != nil {
+				log.Printf("Failed to save DNS checkpoint: %v", err)
 			}
 
 			// Use adaptive delay based on current mode and system state
@@ -190,7 +296,7 @@ func (s *Scanner) processDNSBatch(domains []string) error {
 	return nil
 }
 
-func (s *Scanner) extractAndProcessIPs() ([]string, error) {
+func (s *Scanner) extractAndProcessIPs(ctx context.Context) ([]string, error) {
 	// Get all unique IPs from domains
 	uniqueIPsMap := make(map[string]bool)
 	
@@ -213,14 +319,14 @@ func (s *Scanner) extractAndProcessIPs() ([]string, error) {
 	}
 
 	// Process reverse DNS lookups for new IPs
-	if err := s.processReverseDNS(uniqueIPs); err != nil {
+	if err := s.processReverseDNS(ctx, uniqueIPs); err != nil {
 		log.Printf("Error processing reverse DNS: %v", err)
 	}
 
 	return uniqueIPs, nil
 }
 
-func (s *Scanner) processReverseDNS(ips []string) error {
+func (s *Scanner) processReverseDNS(ctx context.Context, ips []string) error {
 	fmt.Printf("🔄 Processing reverse DNS for %d IPs\n", len(ips))
 	
 	profile := s.config.GetCurrentProfile()
@@ -235,6 +341,10 @@ func (s *Scanner) processReverseDNS(ips []string) error {
 	semaphore := make(chan struct{}, profile.WorkerCount)
 
 	for _, ip := range ips {
+		if ctx.Err() != nil {
+			break
+		}
+
 		// Throttle during conservation mode
 		if s.scheduler.ShouldThrottle() && len(ips) > maxConcurrent {
 			time.Sleep(time.Millisecond * 50)
@@ -246,12 +356,16 @@ func (s *Scanner) processReverseDNS(ips []string) error {
 			semaphore <- struct{}{} // Acquire
 			defer func() { <-semaphore }() // Release
 
-			ptrRecord, _ := s.dns.ReverseLookup(targetIP)
+			start := time.Now()
+			ptrRecords, err := s.dns.ReverseLookupAll(targetIP)
 			
 			ipResult := &database.IPResult{
-				IP:          targetIP,
-				PTRRecord:   ptrRecord,
-				ProcessedAt: time.Now(),
+				IP:             targetIP,
+				PTRRecords:     ptrRecords,
+				Family:         database.IPFamily(targetIP),
+				ProcessedAt:    time.Now(),
+				LookupDuration: time.Since(start),
+				ErrorClass:     dns.ClassifyError(err),
 			}
 
 			if err := s.db.SaveIP(ipResult); err != nil {
@@ -267,14 +381,30 @@ func (s *Scanner) processReverseDNS(ips []string) error {
 	return nil
 }
 
-func (s *Scanner) scanPorts(ips []string) error {
+func (s *Scanner) scanPorts(ctx context.Context, ips []string) error {
 	ports := s.config.AllPorts()
 	
+	// Work out every (ip, port) pair still to scan up front
+	pending, err := s.db.GetUnscannedPairs(ips, ports)
+	if err != nil {
+		return fmt.Errorf("failed to get unscanned ports: %w", err)
+	}
+	
 	for _, port := range ports {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		unscannedIPs := pending[port]
+		if len(unscannedIPs) == 0 {
+			fmt.Printf("Port %d already scanned on all IPs\n", port)
+			continue
+		}
+		
 		mode := s.config.GetModeString()
-		fmt.Printf("%s Scanning port %d on %d IPs\n", mode, port, len(ips))
+		fmt.Printf("%s Scanning port %d on %d IPs\n", mode, port, len(unscannedIPs))
 		
-		if err := s.scanPortOnIPs(ips, port); err != nil {
+		if err := s.scanPortOnIPs(ctx, unscannedIPs, port); err != nil {
 			log.Printf("Error scanning port %d: %v", port, err)
 			continue
 		}
@@ -288,25 +418,10 @@ func (s *Scanner) scanPorts(ips []string) error {
 	return nil
 }
 
-func (s *Scanner) scanPortOnIPs(ips []string, port int) error {
-	// Filter IPs that haven't been scanned for this port
-	var unscannedIPs []string
-	for _, ip := range ips {
-		scanned, err := s.db.IsPortScanned(ip, port)
-		if err != nil {
-			log.Printf("Error checking port scan status for %s:%d: %v", ip, port, err)
-			continue
-		}
-		if !scanned {
-			unscannedIPs = append(unscannedIPs, ip)
-		}
-	}
-
-	if len(unscannedIPs) == 0 {
-		fmt.Printf("Port %d already scanned on all IPs\n", port)
-		return nil
-	}
-
+// scanPortOnIPs scans port on each address in batches. It keeps no
+// checkpoint: every result is stored as it arrives, and the next run only
+// gets the addresses GetUnscannedPairs still reports.
+func (s *Scanner) scanPortOnIPs(ctx context.Context, unscannedIPs []string, port int) error {
 	fmt.Printf("Scanning port %d on %d unscanned IPs\n", port, len(unscannedIPs))
 
 	// Process in batches with dynamic sizing
@@ -315,6 +430,10 @@ func (s *Scanner) scanPortOnIPs(ips []string, port int) error {
 	totalBatches := (len(unscannedIPs) + batchSize - 1) / batchSize
 
 	for batchIndex := 0; batchIndex < totalBatches; batchIndex++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+
 		start := batchIndex * batchSize
 		end := start + batchSize
 		if end > len(unscannedIPs) {
@@ -330,15 +449,6 @@ func (s *Scanner) scanPortOnIPs(ips []string, port int) error {
 			log.Printf("Error scanning port %d batch %d: %v", port, batchIndex, err)
 			continue
 		}
-
-		// Save progress
-		progress := &database.Progress{
-			Phase:       fmt.Sprintf("port_scan_%d", port),
-			BatchIndex:  batchIndex,
-			ItemIndex:   end,
-			CompletedAt: time.Now(),
-		}
-		s.db.SaveProgress(progress)
 	}
 
 	return nil
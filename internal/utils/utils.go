@@ -1,25 +1,15 @@
 package utils
 
 import (
-	"strings"
+	"github.com/recon-scanner/internal/normalize"
 )
 
+// CleanDomain returns the normalized form of domain, or "" when it is not a
+// valid domain name. Use normalize.Domain to learn why an entry was rejected.
 func CleanDomain(domain string) string {
-	// Remove quotes if present
-	domain = strings.Trim(domain, `"`)
-	
-	// Remove protocol if present
-	domain = strings.TrimPrefix(domain, "http://")
-	domain = strings.TrimPrefix(domain, "https://")
-	
-	// Remove www prefix
-	domain = strings.TrimPrefix(domain, "www.")
-	
-	// Remove trailing slash
-	domain = strings.TrimSuffix(domain, "/")
-	
-	// Convert to lowercase
-	domain = strings.ToLower(domain)
-	
-	return strings.TrimSpace(domain)
-}
\ No newline at end of file
+	name, err := normalize.Domain(domain, normalize.Options{})
+	if err != nil {
+		return ""
+	}
+	return name
+}
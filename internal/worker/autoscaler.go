@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/monitoring"
+)
+
+// Number of scaling events kept in memory for ScalingEvents
+const maxRecentScalingEvents = 100
+
+func (wp *WorkerPool) scaleLoop() {
+	interval := wp.config.ScaleCheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			wp.scale()
+		case <-wp.ctx.Done():
+			return
+		}
+	}
+}
+
+// scale moves the worker count one WorkerScaleStep towards the monitor's
+// optimal count. After a thermal scale-down it refuses to grow again until
+// the CPU has cooled below CooldownTemp, so the pool does not oscillate
+// around ThrottleTemp.
+func (wp *WorkerPool) scale() {
+	metrics := wp.monitor.GetMetrics()
+	target := wp.monitor.GetOptimalWorkerCount()
+	current := wp.WorkerCount()
+
+	step := wp.config.WorkerScaleStep
+	if step <= 0 {
+		step = 1
+	}
+
+	event := database.ScalingEvent{
+		Time:          time.Now(),
+		FromWorkers:   current,
+		TargetWorkers: target,
+		CPUTemp:       metrics.CPUTemp,
+		MemoryPercent: metrics.MemoryPercent,
+	}
+
+	switch {
+	case target < current:
+		if metrics.CPUTemp > wp.config.ThrottleTemp {
+			wp.coolingDown = true
+		}
+
+		event.Direction = "down"
+		event.ToWorkers = wp.removeWorkers(minInt(step, current-target))
+		event.Reason = wp.scaleDownReason(metrics, target, current)
+		log.Printf("Scaled down workers by %d, total: %d", current-event.ToWorkers, event.ToWorkers)
+
+	case target > current:
+		if wp.coolingDown && metrics.CPUTemp > wp.config.CooldownTemp {
+			event.Direction = "hold"
+			event.ToWorkers = current
+			event.Reason = fmt.Sprintf("waiting for CPU to cool below %.1f°C (now %.1f°C)", wp.config.CooldownTemp, metrics.CPUTemp)
+			break
+		}
+		wp.coolingDown = false
+
+		event.Direction = "up"
+		event.ToWorkers = wp.addWorkers(minInt(step, target-current))
+		event.Reason = "system has headroom"
+		log.Printf("Scaled up workers by %d, total: %d", event.ToWorkers-current, event.ToWorkers)
+
+	default:
+		return
+	}
+
+	wp.recordScalingEvent(event)
+}
+
+// scaleDownReason names the limits that were exceeded, or says the target
+// dropped for some other reason, such as MaxWorkers being lowered.
+func (wp *WorkerPool) scaleDownReason(metrics monitoring.SystemMetrics, target, current int) string {
+	var reasons []string
+	if metrics.CPUTemp > wp.config.ThrottleTemp {
+		reasons = append(reasons, fmt.Sprintf("CPU %.1f°C above %.1f°C", metrics.CPUTemp, wp.config.ThrottleTemp))
+	}
+	if metrics.MemoryPercent > monitoring.MemoryThrottlePercent {
+		reasons = append(reasons, fmt.Sprintf("memory %.1f%% above %.0f%%", metrics.MemoryPercent, monitoring.MemoryThrottlePercent))
+	}
+	if len(reasons) == 0 {
+		return fmt.Sprintf("target %d workers below current %d", target, current)
+	}
+	return strings.Join(reasons, ", ")
+}
+
+func (wp *WorkerPool) recordScalingEvent(event database.ScalingEvent) {
+	wp.eventsMu.Lock()
+	wp.events = append(wp.events, event)
+	if len(wp.events) > maxRecentScalingEvents {
+		wp.events = wp.events[len(wp.events)-maxRecentScalingEvents:]
+	}
+	wp.eventsMu.Unlock()
+
+	if err := wp.db.SaveScalingEvent(&event); err != nil {
+		log.Printf("Failed to save scaling event: %v", err)
+	}
+}
+
+// ScalingEvents returns the recent scaling decisions, oldest first.
+func (wp *WorkerPool) ScalingEvents() []database.ScalingEvent {
+	wp.eventsMu.Lock()
+	defer wp.eventsMu.Unlock()
+
+	events := make([]database.ScalingEvent, len(wp.events))
+	copy(events, wp.events)
+	return events
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+)
+
+// Defaults when the configuration leaves the durable queue settings empty
+const (
+	defaultTaskLeaseTimeout  = 10 * time.Minute
+	defaultQueuePollInterval = time.Second
+)
+
+// feedLoop leases due tasks from the durable queue whenever the in-memory
+// priority queue has room, and periodically returns expired leases to pending.
+func (wp *WorkerPool) feedLoop() {
+	defer close(wp.feederDone)
+
+	lease := wp.config.TaskLeaseTimeout
+	if lease <= 0 {
+		lease = defaultTaskLeaseTimeout
+	}
+	poll := wp.config.QueuePollInterval
+	if poll <= 0 {
+		poll = defaultQueuePollInterval
+	}
+
+	requeueTicker := time.NewTicker(lease / 2)
+	defer requeueTicker.Stop()
+
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-requeueTicker.C:
+			if n, err := wp.db.RequeueExpiredLeases(); err != nil {
+				log.Printf("Failed to requeue expired leases: %v", err)
+			} else if n > 0 {
+				log.Printf("Requeued %d tasks whose lease expired", n)
+			}
+		default:
+		}
+
+		if wp.fill(lease) > 0 {
+			continue
+		}
+
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// fill leases enough tasks to top up the in-memory queue and returns how many it added.
+func (wp *WorkerPool) fill(lease time.Duration) int {
+	free := wp.tasks.capacity - wp.tasks.len()
+	if free < wp.tasks.capacity/2 {
+		return 0
+	}
+
+	leased, err := wp.db.LeaseTasks(free, lease)
+	if err != nil {
+		log.Printf("Failed to lease tasks: %v", err)
+		return 0
+	}
+
+	for i, qt := range leased {
+		if !wp.tasks.push(fromQueuedTask(qt)) {
+			var unused []Task
+			for _, rest := range leased[i:] {
+				unused = append(unused, fromQueuedTask(rest))
+			}
+			wp.releaseTasks(unused)
+			return i
+		}
+	}
+	return len(leased)
+}
+
+// releaseTasks hands leased tasks back to the durable queue untouched.
+func (wp *WorkerPool) releaseTasks(tasks []Task) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	if err := wp.db.ReleaseTasks(ids); err != nil {
+		log.Printf("Failed to release %d tasks: %v", len(ids), err)
+	}
+}
+
+// WaitIdle blocks until the durable queue has no pending or leased tasks
+// left, or ctx is cancelled.
+func (wp *WorkerPool) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		counts, err := wp.db.CountTasksByState()
+		if err != nil {
+			return err
+		}
+		if counts[database.TaskPending]+counts[database.TaskLeased] == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func toQueuedTask(task Task) database.QueuedTask {
+	return database.QueuedTask{
+		ID:          task.ID,
+		Type:        task.Type,
+		Data:        fmt.Sprint(task.Data),
+		Rank:        task.Rank,
+		Priority:    task.Priority,
+		Retry:       task.Retry,
+		AvailableAt: time.Now(),
+	}
+}
+
+func fromQueuedTask(qt database.QueuedTask) Task {
+	return Task{
+		ID:       qt.ID,
+		Type:     qt.Type,
+		Data:     qt.Data,
+		Rank:     qt.Rank,
+		Priority: qt.Priority,
+		Retry:    qt.Retry,
+	}
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Task priorities, higher runs first. Bulk list work uses PriorityBulk so
+// anything more urgent overtakes it.
+const (
+	PriorityBulk     = 1
+	PriorityRecheck  = 5 // Re-checks of previously open ports
+	PriorityRetry    = 7
+	PriorityOperator = 10 // Domains injected by hand
+)
+
+// Default time a task must wait to be worth one extra priority level
+const defaultPriorityAging = 30 * time.Second
+
+type queuedTask struct {
+	task     Task
+	deadline time.Time // enqueue time minus the priority head start
+	seq      uint64
+}
+
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if !h[i].deadline.Equal(h[j].deadline) {
+		return h[i].deadline.Before(h[j].deadline)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// taskQueue is a bounded priority queue. Each task is ordered by its enqueue
+// time minus priority*aging, so higher priorities jump ahead but a
+// low-priority task that has waited long enough still beats fresh urgent
+// work and cannot starve.
+type taskQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    taskHeap
+	depths   map[int]int
+	capacity int
+	aging    time.Duration
+	seq      uint64
+	closed   bool
+}
+
+func newTaskQueue(capacity int, aging time.Duration) *taskQueue {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if aging <= 0 {
+		aging = defaultPriorityAging
+	}
+
+	q := &taskQueue{
+		depths:   make(map[int]int),
+		capacity: capacity,
+		aging:    aging,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push blocks while the queue is full and reports false once it is closed.
+func (q *taskQueue) push(task Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) >= q.capacity && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+
+	q.seq++
+	heap.Push(&q.items, &queuedTask{
+		task:     task,
+		deadline: time.Now().Add(-time.Duration(task.Priority) * q.aging),
+		seq:      q.seq,
+	})
+	q.depths[task.Priority]++
+	q.notEmpty.Signal()
+	return true
+}
+
+// pop blocks until a task is available. It reports false when the queue is
+// closed and drained, or when quit is closed while waiting.
+func (q *taskQueue) pop(quit <-chan struct{}) (Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 {
+		if q.closed {
+			return Task{}, false
+		}
+		select {
+		case <-quit:
+			return Task{}, false
+		default:
+		}
+		q.notEmpty.Wait()
+	}
+
+	item := heap.Pop(&q.items).(*queuedTask)
+	q.depths[item.task.Priority]--
+	if q.depths[item.task.Priority] == 0 {
+		delete(q.depths, item.task.Priority)
+	}
+	q.notFull.Signal()
+	return item.task, true
+}
+
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// drain removes and returns every queued task.
+func (q *taskQueue) drain() []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tasks := make([]Task, 0, len(q.items))
+	for _, item := range q.items {
+		tasks = append(tasks, item.task)
+	}
+	q.items = nil
+	q.depths = make(map[int]int)
+	q.notFull.Broadcast()
+	return tasks
+}
+
+// wake lets idle workers notice that they have been retired.
+func (q *taskQueue) wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notEmpty.Broadcast()
+}
+
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// depthByPriority returns a snapshot of queued tasks per priority.
+func (q *taskQueue) depthByPriority() map[int]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depths := make(map[int]int, len(q.depths))
+	for priority, n := range q.depths {
+		depths[priority] = n
+	}
+	return depths
+}
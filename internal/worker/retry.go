@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/recon-scanner/internal/database"
+	"github.com/recon-scanner/internal/dns"
+)
+
+// Upper bound for a single backoff, however many attempts were made
+const maxRetryDelay = 5 * time.Minute
+
+// Dead-letter class of a task whose result could not be stored because the
+// database stayed locked
+const errorClassStoreBusy = "store_busy"
+
+// retryOrDeadLetter puts a failed task back into the durable queue behind a
+// jittered exponential backoff, or moves it to the dead-letter table once it
+// has used up RetryAttempts or failed in a way retrying cannot fix. It
+// reports whether a retry was scheduled.
+func (wp *WorkerPool) retryOrDeadLetter(task Task, result Result) bool {
+	if !retryable(result.Error) || task.Retry >= wp.config.RetryAttempts {
+		wp.deadLetter(task, result.Error)
+		return false
+	}
+
+	priority := task.Priority
+	if priority < PriorityRetry {
+		priority = PriorityRetry
+	}
+
+	availableAt := time.Now().Add(wp.backoff(task.Retry))
+	if err := wp.db.RetryTask(task.ID, task.Retry+1, priority, availableAt, wp.tasks.aging, result.Error.Error()); err != nil {
+		log.Printf("Failed to schedule retry of task %s: %v", task.ID, err)
+	}
+	return true
+}
+
+// retryable reports whether a task that failed with err may succeed if run
+// again: a lookup that can be retried, or a save that hit a locked database.
+func retryable(err error) bool {
+	return dns.IsRetryable(err) || database.IsBusy(err)
+}
+
+func errorClass(err error) string {
+	if database.IsBusy(err) {
+		return errorClassStoreBusy
+	}
+	return dns.ClassifyError(err)
+}
+
+// backoff returns RetryBaseDelay * BackoffMultiplier^attempt with ±50% jitter.
+func (wp *WorkerPool) backoff(attempt int) time.Duration {
+	base := wp.config.RetryBaseDelay
+	if base <= 0 {
+		base = time.Second
+	}
+
+	multiplier := wp.config.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(base) * math.Pow(multiplier, float64(attempt))
+	delay *= 0.5 + rand.Float64()
+	if delay > float64(maxRetryDelay) {
+		delay = float64(maxRetryDelay)
+	}
+	return time.Duration(delay)
+}
+
+func (wp *WorkerPool) deadLetter(task Task, cause error) {
+	dl := &database.DeadLetter{
+		TaskID:     task.ID,
+		TaskType:   task.Type,
+		Data:       fmt.Sprint(task.Data),
+		Rank:       task.Rank,
+		Attempts:   task.Retry + 1,
+		ErrorClass: errorClass(cause),
+		FailedAt:   time.Now(),
+	}
+	if cause != nil {
+		dl.LastError = cause.Error()
+	}
+
+	if err := wp.db.SaveDeadLetter(dl); err != nil {
+		log.Printf("Failed to dead-letter task %s: %v", task.ID, err)
+	}
+	if err := wp.db.FailTask(task.ID, dl.LastError); err != nil {
+		log.Printf("Failed to mark task %s failed: %v", task.ID, err)
+	}
+}
@@ -1,18 +1,25 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/recon-scanner/internal/config"
 	"github.com/recon-scanner/internal/database"
 	"github.com/recon-scanner/internal/dns"
+	"github.com/recon-scanner/internal/monitoring"
 )
 
 type Task struct {
 	ID       string
 	Type     string
 	Data     interface{}
+	Rank     int64 // Input list rank of the domain, 0 when unknown
 	Priority int
 	Retry    int
 }
@@ -21,12 +28,275 @@ type Result struct {
 	TaskID  string
 	Success bool
 	Data    *database.DomainResult
-	Error   error
+	Error   error // Set on failure, and on success when some lookups failed
 }
 
+// ErrPoolStopped is returned when a task is submitted after Stop.
+var ErrPoolStopped = errors.New("worker pool stopped")
+
+// DomainTaskID is the durable queue ID of a domain's DNS task, so loading
+// the same list twice never queues a domain twice.
+func DomainTaskID(domain string) string {
+	return "dns:" + domain
+}
+
+// How often live counters are pushed into the system monitor
+const statsInterval = 5 * time.Second
+
 type WorkerPool struct {
+	config   *config.HighPerformanceConfig
+	monitor  *monitoring.SystemMonitor
 	resolver *dns.Resolver
 	db       *database.Database
+
+	tasks   *taskQueue
+	results chan Result
+
+	mu       sync.Mutex
+	workers  map[int]chan struct{} // quit channel per live worker
+	nextID   int
+	stopping bool
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	// Closed once the durable queue feeder has exited, see durable_queue.go
+	feederDone chan struct{}
+
+	// Autoscaler state, see autoscaler.go
+	coolingDown bool
+	eventsMu    sync.Mutex
+	events      []database.ScalingEvent
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	processed int64
+	failed    int64
+}
+
+func NewWorkerPool(cfg *config.HighPerformanceConfig, monitor *monitoring.SystemMonitor, db *database.Database, resolver *dns.Resolver) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &WorkerPool{
+		config:   cfg,
+		monitor:  monitor,
+		resolver: resolver,
+		db:       db,
+		tasks:    newTaskQueue(cfg.MaxBatchSize, cfg.PriorityAging),
+		results:  make(chan Result, cfg.MaxWorkers),
+		workers:  make(map[int]chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+
+		feederDone: make(chan struct{}),
+	}
+}
+
+func (wp *WorkerPool) Start() {
+	// Leases left behind can only belong to a process that died
+	if n, err := wp.db.ReleaseAllLeases(); err != nil {
+		log.Printf("Failed to release stale task leases: %v", err)
+	} else if n > 0 {
+		log.Printf("Recovered %d tasks leased by a previous run", n)
+	}
+
+	wp.addWorkers(wp.config.MinWorkers)
+	go wp.feedLoop()
+	go wp.statsLoop()
+	go wp.scaleLoop()
+
+	log.Printf("Worker pool started with %d workers (max %d)", wp.WorkerCount(), wp.config.MaxWorkers)
+}
+
+// Stop lets the workers finish the tasks they are running and then closes
+// the Results channel. Tasks still waiting in memory go back to pending in
+// the durable queue, so nothing is lost and the next run resumes them.
+func (wp *WorkerPool) Stop() {
+	wp.stopOnce.Do(func() {
+		wp.cancel()
+		<-wp.feederDone
+
+		wp.tasks.close()
+		wp.releaseTasks(wp.tasks.drain())
+
+		// No new workers may be started while draining
+		wp.mu.Lock()
+		wp.stopping = true
+		wp.mu.Unlock()
+
+		wp.wg.Wait()
+		wp.reportStats()
+		close(wp.results)
+
+		log.Printf("Worker pool stopped after %d tasks (%d with errors)",
+			atomic.LoadInt64(&wp.processed), atomic.LoadInt64(&wp.failed))
+	})
+}
+
+// SubmitTask adds a task to the durable queue.
+func (wp *WorkerPool) SubmitTask(task Task) error {
+	_, err := wp.SubmitTasks([]Task{task})
+	return err
+}
+
+// SubmitTasks adds tasks to the durable queue in one transaction and returns
+// how many were new. Tasks already known by ID are not added again; queued
+// ones keep the higher priority and finished ones are skipped.
+func (wp *WorkerPool) SubmitTasks(tasks []Task) (int, error) {
+	if wp.ctx.Err() != nil {
+		return 0, ErrPoolStopped
+	}
+
+	queued := make([]database.QueuedTask, len(tasks))
+	for i, task := range tasks {
+		queued[i] = toQueuedTask(task)
+	}
+	counts, err := wp.db.EnqueueTasks(queued, false, wp.tasks.aging)
+	return counts.Added, err
+}
+
+// PriorityAging is the wait that earns a queued task one priority level. It
+// is what other writers of the durable queue must pass to the database.
+func (wp *WorkerPool) PriorityAging() time.Duration {
+	return wp.tasks.aging
+}
+
+func (wp *WorkerPool) QueueLength() int {
+	return wp.tasks.len()
+}
+
+// Results delivers one Result per processed task. It must be drained,
+// otherwise workers block once its buffer fills up.
+func (wp *WorkerPool) Results() <-chan Result {
+	return wp.results
+}
+
+func (wp *WorkerPool) WorkerCount() int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return len(wp.workers)
+}
+
+func (wp *WorkerPool) addWorkers(n int) int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	if wp.stopping {
+		return len(wp.workers)
+	}
+
+	for i := 0; i < n && len(wp.workers) < wp.config.MaxWorkers; i++ {
+		quit := make(chan struct{})
+		id := wp.nextID
+		wp.nextID++
+		wp.workers[id] = quit
+
+		wp.wg.Add(1)
+		go wp.worker(id, quit)
+	}
+	return len(wp.workers)
+}
+
+// removeWorkers retires up to n workers; each finishes its current task first.
+func (wp *WorkerPool) removeWorkers(n int) int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	for id, quit := range wp.workers {
+		if n == 0 || len(wp.workers) <= wp.config.MinWorkers {
+			break
+		}
+		close(quit)
+		delete(wp.workers, id)
+		n--
+	}
+	wp.tasks.wake()
+	return len(wp.workers)
+}
+
+func (wp *WorkerPool) worker(id int, quit <-chan struct{}) {
+	defer wp.wg.Done()
+
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		task, ok := wp.tasks.pop(quit)
+		if !ok {
+			wp.mu.Lock()
+			delete(wp.workers, id)
+			wp.mu.Unlock()
+			return
+		}
+		wp.handleResult(task, wp.processTask(task))
+	}
+}
+
+func (wp *WorkerPool) processTask(task Task) Result {
+	switch task.Type {
+	case "DNS":
+		return wp.processDomainTask(task)
+	default:
+		return Result{
+			TaskID:  task.ID,
+			Success: false,
+			Error:   fmt.Errorf("unknown task type %q", task.Type),
+		}
+	}
+}
+
+func (wp *WorkerPool) handleResult(task Task, result Result) {
+	atomic.AddInt64(&wp.processed, 1)
+	if result.Error != nil {
+		atomic.AddInt64(&wp.failed, 1)
+	}
+	if !result.Success {
+		if wp.retryOrDeadLetter(task, result) {
+			return // The retry reports the final result
+		}
+	} else if err := wp.db.CompleteTask(task.ID); err != nil {
+		log.Printf("Failed to mark task %s done: %v", task.ID, err)
+	}
+
+	wp.results <- result
+}
+
+func (wp *WorkerPool) statsLoop() {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			wp.reportStats()
+		case <-wp.ctx.Done():
+			return
+		}
+	}
+}
+
+func (wp *WorkerPool) reportStats() {
+	processed := atomic.LoadInt64(&wp.processed)
+	failed := atomic.LoadInt64(&wp.failed)
+
+	errorRate := 0.0
+	if processed > 0 {
+		errorRate = float64(failed) / float64(processed) * 100
+	}
+
+	wp.monitor.UpdateStats(wp.WorkerCount(), processed, errorRate)
+	wp.monitor.UpdateQueueDepths(wp.tasks.depthByPriority())
+
+	cache := wp.resolver.CacheStats()
+	wp.monitor.UpdateDNSCache(cache.Hits, cache.Misses, cache.Entries, cache.Bytes)
+
+	// Give memory back before the monitor has to force collections
+	if wp.monitor.GetMetrics().MemoryUsage > wp.config.GCThreshold {
+		wp.resolver.ShrinkCache(0.5)
+	}
 }
 
 func (wp *WorkerPool) processDomainTask(task Task) Result {
@@ -39,38 +309,20 @@ func (wp *WorkerPool) processDomainTask(task Task) Result {
 		}
 	}
 
-	result := &database.DomainResult{
-		Domain:      domain,
-		ProcessedAt: time.Now(),
-	}
-
 	// DNS Phase
 	startDNS := time.Now()
-	dnsResult, err := wp.resolver.ResolveDomain(domain)
-	result.DNSDuration = time.Since(startDNS)
-	if err != nil {
+	result, lookupErr := wp.resolver.ResolveDomain(domain)
+	if dns.IsRetryable(lookupErr) {
 		return Result{
 			TaskID:  task.ID,
 			Success: false,
-			Error:   err,
+			Error:   lookupErr,
 		}
 	}
-	result.ARecords = dnsResult.ARecords
-	result.AAAARecords = dnsResult.AAAARecords
-	result.CNAMERecords = dnsResult.CNAMERecords
-	result.MXRecords = dnsResult.MXRecords
-	result.NSRecords = dnsResult.NSRecords
-	result.TXTRecords = dnsResult.TXTRecords
-
-	// PortScan Phase (stub example, replace with real logic if needed)
-	startPort := time.Now()
-	time.Sleep(10 * time.Millisecond)
-	result.PortScanDuration = time.Since(startPort)
+	result.Rank = task.Rank
+	result.DNSDuration = time.Since(startDNS)
 
-	// ReverseLookup Phase (stub example, replace with real logic if needed)
-	startReverse := time.Now()
-	time.Sleep(5 * time.Millisecond)
-	result.ReverseDuration = time.Since(startReverse)
+	// Port scan and reverse lookup durations stay zero; the pool runs neither
 
 	if err := wp.db.SaveDomain(result); err != nil {
 		log.Printf("Error saving domain result: %v", err)
@@ -81,9 +333,11 @@ func (wp *WorkerPool) processDomainTask(task Task) Result {
 		}
 	}
 
+	// The task succeeded even if some lookups failed; their statuses are stored
 	return Result{
 		TaskID:  task.ID,
 		Success: true,
 		Data:    result,
+		Error:   lookupErr,
 	}
 }
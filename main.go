@@ -1,7 +1,9 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -13,7 +15,6 @@ import (
 	"github.com/recon-scanner/internal/config"
 	"github.com/recon-scanner/internal/database"
 	"github.com/recon-scanner/internal/scanner"
-	"github.com/recon-scanner/internal/utils"
 )
 
 func main() {
@@ -37,6 +38,12 @@ func main() {
 
 	// Initialize configuration
 	cfg := config.New()
+	flag.BoolVar(&cfg.EnumerateSubdomains, "enumerate", cfg.EnumerateSubdomains, "brute-force subdomains of the resolved domains before scanning")
+	flag.StringVar(&cfg.SubdomainWordlist, "wordlist", cfg.SubdomainWordlist, "subdomain labels to try, one per line (default: built-in list)")
+	flag.BoolVar(&cfg.SubdomainPermutations, "permutations", cfg.SubdomainPermutations, "also try variations of the subdomains found, e.g. dev-api or api2")
+	flag.BoolVar(&cfg.ZoneTransfers, "axfr", cfg.ZoneTransfers, "attempt zone transfers against every name server of each domain")
+	flag.BoolVar(&cfg.MailSecurity, "mail-security", cfg.MailSecurity, "check and grade SPF, DMARC, MTA-STS, TLS-RPT, BIMI and DKIM of each domain")
+	flag.Parse()
 	
 	// Display current time zone and schedule
 	location, err := time.LoadLocation(cfg.Timezone)
@@ -65,16 +72,14 @@ func main() {
 	}
 	defer db.Close()
 
-	// Load domains from CSV
-	domains, err := loadDomainsFromCSV(cfg.CSVFile)
-	if err != nil {
-		log.Fatal("Failed to load domains:", err)
-	}
-
-	fmt.Printf("📊 Loaded %d domains from CSV\n", len(domains))
-	log.Printf("Loaded %d domains from %s", len(domains), cfg.CSVFile)
+	// Domains are streamed from the CSV rather than loaded up front
+	fmt.Printf("📊 Streaming domains from %s\n", cfg.CSVFile)
+	log.Printf("Streaming domains from %s", cfg.CSVFile)
 
 	// Set up graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	
@@ -82,10 +87,9 @@ func main() {
 		<-c
 		fmt.Println("\n🛑 Received shutdown signal, gracefully stopping...")
 		log.Printf("Received shutdown signal")
-		
-		// Give some time for graceful shutdown
-		time.Sleep(2 * time.Second)
-		os.Exit(0)
+		// A second signal kills the process without waiting
+		signal.Stop(c)
+		cancel()
 	}()
 
 	// Initialize scanner
@@ -93,9 +97,14 @@ func main() {
 
 	// Start the reconnaissance process
 	fmt.Println("🎯 Starting reconnaissance process...")
-	log.Printf("Starting reconnaissance with %d domains", len(domains))
+	log.Printf("Starting reconnaissance")
 	
-	err = scannerInstance.Run(domains)
+	err = scannerInstance.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("🛑 Stopped; progress is saved and the next run resumes from it")
+		log.Printf("=== RECON SCANNER STOPPED ===")
+		return
+	}
 	if err != nil {
 		log.Fatal("Scanner failed:", err)
 	}
@@ -103,30 +112,3 @@ func main() {
 	fmt.Println("✅ Reconnaissance completed successfully!")
 	log.Printf("=== RECON SCANNER COMPLETED ===")
 }
-
-func loadDomainsFromCSV(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open CSV file: %w", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV: %w", err)
-	}
-
-	var domains []string
-	// Skip header row
-	for i := 1; i < len(records); i++ {
-		if len(records[i]) >= 2 {
-			domain := utils.CleanDomain(records[i][1])
-			if domain != "" {
-				domains = append(domains, domain)
-			}
-		}
-	}
-
-	return domains, nil
-}
\ No newline at end of file
@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 	
+	"github.com/recon-scanner/internal/checkpoint"
 	"github.com/recon-scanner/internal/config"
 	"github.com/recon-scanner/internal/database"
 	"github.com/recon-scanner/internal/dns"
+	"github.com/recon-scanner/internal/input"
 	"github.com/recon-scanner/internal/monitoring"
 	"github.com/recon-scanner/internal/worker"
 )
@@ -22,6 +26,35 @@ func main() {
 	// Set up high-performance configuration
 	cfg := config.NewHighPerformanceConfig()
 	
+	replay := flag.Bool("replay-dead-letters", false, "re-run tasks from the dead-letter table instead of the CSV")
+	flag.StringVar(&cfg.CSVFile, "input", cfg.CSVFile, "domain list to load, optionally gzip or zstd compressed; - reads stdin, which is not resumed after an interruption")
+	flag.StringVar(&cfg.InputFormat, "format", cfg.InputFormat, "input format: auto, tranco, umbrella, majestic or text")
+	flag.BoolVar(&cfg.StripWWW, "strip-www", cfg.StripWWW, "fold www.example.com into example.com")
+	recordTypes := flag.String("record-types", strings.Join(cfg.RecordTypes, ","), "comma-separated record types to look up, e.g. A,AAAA,MX,SOA,CAA,SRV,DS,DNSKEY,HTTPS,SVCB")
+	upstreams := flag.String("upstreams", "", "comma-separated DNS resolvers to spread queries over: host[:port], tls://host[:port][#name] for DoT or https://host/path for DoH (default: /etc/resolv.conf)")
+	flag.StringVar(&cfg.DoHMethod, "doh-method", cfg.DoHMethod, "HTTP method for DoH upstreams: POST or GET")
+	flag.StringVar(&cfg.UpstreamCAFile, "upstream-ca", cfg.UpstreamCAFile, "PEM file of extra CAs trusted for DoT and DoH upstreams")
+	flag.IntVar(&cfg.WildcardProbes, "wildcard-probes", cfg.WildcardProbes, "random labels resolved under each apex to detect wildcard DNS, 0 to disable")
+	flag.BoolVar(&cfg.ZoneTransfers, "axfr", cfg.ZoneTransfers, "attempt AXFR, then IXFR, against every name server of each domain and store what they hand out")
+	flag.IntVar(&cfg.ZoneTransferPort, "axfr-port", cfg.ZoneTransferPort, "TCP port to ask name servers for zone transfers on")
+	flag.BoolVar(&cfg.MailSecurity, "mail-security", cfg.MailSecurity, "check and grade SPF, DMARC, MTA-STS, TLS-RPT, BIMI and DKIM of each domain")
+	dkimSelectors := flag.String("dkim-selectors", strings.Join(cfg.DKIMSelectors, ","), "comma-separated DKIM selectors to look for")
+	flag.BoolVar(&cfg.DNSSEC, "dnssec", cfg.DNSSEC, "validate DNSSEC and store a secure/insecure/bogus/indeterminate status per domain")
+	flag.BoolVar(&cfg.Iterative, "iterative", cfg.Iterative, "resolve from the root servers down instead of through upstream resolvers")
+	flag.IntVar(&cfg.UpstreamQPS, "upstream-qps", cfg.UpstreamQPS, "queries per second ceiling for each upstream resolver, 0 for none")
+	flag.StringVar(&cfg.CNAMEFingerprintFile, "cname-fingerprints", cfg.CNAMEFingerprintFile, "JSON file of provider fingerprints for dangling CNAME detection (default: built-in set)")
+	flag.DurationVar(&cfg.DanglingHTTPTimeout, "dangling-http-timeout", cfg.DanglingHTTPTimeout, "fetch the page of domains whose CNAME matches a provider and look for its unclaimed text, waiting at most this long; 0 skips the fetch")
+	flag.Parse()
+	
+	cfg.RecordTypes = strings.Split(*recordTypes, ",")
+	cfg.DKIMSelectors = nil
+	if *dkimSelectors != "" {
+		cfg.DKIMSelectors = strings.Split(*dkimSelectors, ",")
+	}
+	if *upstreams != "" {
+		cfg.Upstreams = strings.Split(*upstreams, ",")
+	}
+	
 	// Set up logging
 	logFile, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -52,6 +85,7 @@ func main() {
 	pool := worker.NewWorkerPool(cfg, monitor, db, resolver)
 	pool.Start()
 	defer pool.Stop()
+	go collectResults(pool)
 	
 	// Print startup information
 	printStartupInfo(cfg, monitor)
@@ -61,7 +95,16 @@ func main() {
 	setupGracefulShutdown(cancel)
 	
 	// Start processing
-	startProcessing(ctx, cfg, pool, monitor)
+	if *replay {
+		err = replayDeadLetters(ctx, db, pool)
+	} else {
+		err = startProcessing(ctx, cfg, db, pool, monitor, resolver)
+	}
+	// Not fatal, so the deferred pool.Stop and db.Close still run
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Scanner failed: %v\n", err)
+		log.Printf("Scanner failed: %v", err)
+	}
 	
 	log.Println("High-performance scanner shutting down")
 }
@@ -94,104 +137,151 @@ func setupGracefulShutdown(cancel context.CancelFunc) {
 	
 	go func() {
 		<-c
-		fmt.Println("\nReceived shutdown signal, gracefully stopping...")
+		fmt.Println("\nReceived shutdown signal, gracefully stopping (signal again to force)...")
 		log.Println("Received shutdown signal")
 		cancel()
-		time.Sleep(5 * time.Second)
-		os.Exit(0)
+		
+		// Unfinished tasks stay in the durable queue, so forcing is safe
+		<-c
+		log.Println("Received second shutdown signal, exiting immediately")
+		os.Exit(1)
 	}()
 }
 
-func startProcessing(ctx context.Context, cfg *config.HighPerformanceConfig, pool *worker.WorkerPool, monitor *monitoring.SystemMonitor) {
-	// Load domains from CSV
-	domains, err := loadDomains(cfg.CSVFile)
-	if err != nil {
-		log.Fatalf("Failed to load domains: %v", err)
+// Checkpoint phase recording how far the CSV has been copied into the queue
+const phaseQueueLoad = "queue_load"
+
+func startProcessing(ctx context.Context, cfg *config.HighPerformanceConfig, db *database.Database, pool *worker.WorkerPool, monitor *monitoring.SystemMonitor, resolver *dns.Resolver) error {
+	// Start metrics reporting
+	go reportMetrics(ctx, monitor, resolver, cfg.MetricsInterval)
+	
+	// Stream domains from the CSV into the durable queue
+	if err := queueDomains(ctx, cfg, db, pool); err != nil {
+		return fmt.Errorf("failed to load domains: %w", err)
 	}
 	
-	fmt.Printf("Loaded %d domains for processing\n", len(domains))
-	log.Printf("Loaded %d domains from %s", len(domains), cfg.CSVFile)
+	waitForQueue(ctx, pool)
+	return nil
+}
+
+func replayDeadLetters(ctx context.Context, db *database.Database, pool *worker.WorkerPool) error {
+	n, err := db.ReplayDeadLetters(worker.PriorityRetry, pool.PriorityAging())
+	if err != nil {
+		return fmt.Errorf("failed to replay dead letters: %w", err)
+	}
 	
-	// Start metrics reporting
-	go reportMetrics(ctx, monitor, cfg.MetricsInterval)
+	fmt.Printf("Replaying %d dead-lettered tasks\n", n)
+	log.Printf("Replaying %d dead-lettered tasks", n)
 	
-	// Process domains in batches
-	processDomains(ctx, domains, pool, cfg, monitor)
+	waitForQueue(ctx, pool)
+	return nil
 }
 
-func loadDomains(filename string) ([]string, error) {
-	file, err := os.Open(filename)
+func queueDomains(ctx context.Context, cfg *config.HighPerformanceConfig, db *database.Database, pool *worker.WorkerPool) error {
+	cp, err := checkpoint.New(db, cfg.CSVFile, cfg.CheckpointInterval)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+		return err
 	}
-	defer file.Close()
 	
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	progress, err := cp.Resume(phaseQueueLoad)
+	if errors.Is(err, checkpoint.ErrInputChanged) {
+		// Queueing is idempotent, so a new list is simply loaded from the start
+		log.Printf("%v, loading it from the start", err)
+		progress = nil
+	} else if err != nil {
+		return err
 	}
 	
-	var domains []string
-	for _, record := range records {
-		if len(record) > 0 {
-			domains = append(domains, record[0])
-		}
+	start := checkpoint.PositionOf(progress)
+	if progress != nil {
+		fmt.Printf("Resuming domain loading from line %d\n", start.Line)
 	}
 	
-	return domains, nil
-}
-
-func processDomains(ctx context.Context, domains []string, pool *worker.WorkerPool, cfg *config.HighPerformanceConfig, monitor *monitoring.SystemMonitor) {
-	batchSize := cfg.BatchSize
-	totalBatches := (len(domains) + batchSize - 1) / batchSize
+	records, errs := input.Stream(ctx, cfg.CSVFile, input.Options{
+		Format:      cfg.InputFormat,
+		StripWWW:    cfg.StripWWW,
+		Invalid: func(line int64, err error) {
+			log.Printf("Skipping input line %d: %v", line, err)
+		},
+		StartIndex:  start.ItemIndex,
+		StartOffset: start.Offset,
+		StartLine:   start.Line,
+		Buffer:      cfg.BatchSize,
+	})
 	
-	for i := 0; i < totalBatches; i++ {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	batchIndex := start.BatchIndex
+	queued, total := 0, 0
+	
+	for {
+		// Queue DNS tasks durably; workers pace themselves by leasing from the queue
+		var (
+			tasks []worker.Task
+			last  input.Record
+		)
+		for record := range records {
+			tasks = append(tasks, worker.Task{
+				ID:       worker.DomainTaskID(record.Domain),
+				Type:     "DNS",
+				Data:     record.Domain,
+				Rank:     record.Rank,
+				Priority: worker.PriorityBulk,
+				Retry:    0,
+			})
+			last = record
+			if len(tasks) >= cfg.BatchSize {
+				break
+			}
 		}
-		
-		start := i * batchSize
-		end := start + batchSize
-		if end > len(domains) {
-			end = len(domains)
+		if len(tasks) == 0 {
+			break
 		}
 		
-		batch := domains[start:end]
-		
-		// Adjust batch size based on system performance
-		if monitor.ShouldThrottle() {
-			batchSize = cfg.MinBatchSize
-		} else {
-			batchSize = cfg.BatchSize
+		n, err := pool.SubmitTasks(tasks)
+		if err != nil {
+			return err
 		}
+		queued += n
+		total += len(tasks)
+		batchIndex++
 		
-		// Submit DNS tasks
-		for j, domain := range batch {
-			task := worker.Task{
-				ID:       fmt.Sprintf("dns_%d_%d", i, j),
-				Type:     "DNS",
-				Data:     domain,
-				Priority: 1,
-				Retry:    0,
-			}
-			pool.SubmitTask(task)
+		pos := checkpoint.Position{
+			BatchIndex: batchIndex,
+			ItemIndex:  last.Index + 1,
+			Offset:     last.Offset,
+			Line:       last.Line,
+		}
+		if err := cp.Save(phaseQueueLoad, pos); err != nil {
+			log.Printf("Failed to save loading checkpoint: %v", err)
 		}
 		
-		fmt.Printf("Submitted batch %d/%d (%d domains)\n", i+1, totalBatches, len(batch))
-		
-		// Add delay between batches if system is under pressure
-		if monitor.ShouldThrottle() {
-			time.Sleep(time.Second * 5)
-		} else {
-			time.Sleep(time.Millisecond * 100)
+		fmt.Printf("Queued batch %d (%d new of %d domains)\n", batchIndex, n, len(tasks))
+	}
+	
+	if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	
+	fmt.Printf("Queued %d new of %d domains, waiting for workers to finish\n", queued, total)
+	log.Printf("Queued %d new of %d domains from %s", queued, total, cfg.CSVFile)
+	return nil
+}
+
+// waitForQueue blocks until every durable task is settled or shutdown starts.
+func waitForQueue(ctx context.Context, pool *worker.WorkerPool) {
+	if err := pool.WaitIdle(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to wait for task queue: %v", err)
+	}
+}
+
+func collectResults(pool *worker.WorkerPool) {
+	for result := range pool.Results() {
+		if !result.Success {
+			log.Printf("Task %s failed: %v", result.TaskID, result.Error)
 		}
 	}
 }
 
-func reportMetrics(ctx context.Context, monitor *monitoring.SystemMonitor, interval time.Duration) {
+func reportMetrics(ctx context.Context, monitor *monitoring.SystemMonitor, resolver *dns.Resolver, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	
@@ -199,8 +289,20 @@ func reportMetrics(ctx context.Context, monitor *monitoring.SystemMonitor, inter
 		select {
 		case <-ticker.C:
 			metrics := monitor.GetMetrics()
-			fmt.Printf("Performance Report - CPU: %.1f°C, Memory: %.1f%%, Workers: %d, Processed: %d, Errors: %.2f%%\n",
-				metrics.CPUTemp, metrics.MemoryPercent, metrics.ActiveWorkers, metrics.ProcessedItems, metrics.ErrorRate)
+			fmt.Printf("Performance Report - CPU: %.1f°C, Memory: %.1f%%, Workers: %d, Processed: %d, Errors: %.2f%%, Queue: %s\n",
+				metrics.CPUTemp, metrics.MemoryPercent, metrics.ActiveWorkers, metrics.ProcessedItems, metrics.ErrorRate,
+				monitoring.FormatQueueDepths(metrics.QueueDepths))
+			fmt.Printf("  DNS cache - Entries: %d, Size: %d MB, Hit rate: %.1f%%\n",
+				metrics.DNSCacheEntries, metrics.DNSCacheBytes/1024/1024, metrics.DNSCacheHitRate())
+			
+			for _, up := range resolver.UpstreamStats() {
+				state := "healthy"
+				if !up.Healthy {
+					state = "ejected: " + up.Reason
+				}
+				fmt.Printf("  Upstream %s - Queries: %d, Errors: %.1f%%, Latency: %v, %s\n",
+					up.Addr, up.Queries, up.ErrorRate*100, up.AvgLatency.Round(time.Millisecond), state)
+			}
 		case <-ctx.Done():
 			return
 		}